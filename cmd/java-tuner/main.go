@@ -1,10 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mattn/go-colorable"
 	"github.com/rs/zerolog"
@@ -35,12 +44,47 @@ Environment Variables:
   JAVA_TUNER_PREFIX         Change env var prefix (default: JAVA_TUNER)
   JAVA_TUNER_CPU_COUNT      Override detected CPU count (same as --cpu-count)
   JAVA_TUNER_MEM_PERCENTAGE Override detected memory percentage (same as --mem-percentage)
+  JAVA_TUNER_MEM_LIMIT      Override detected memory limit (same as --mem-limit)
+  JAVA_TUNER_MIN_HEAP       Lower bound of the heap size (same as --min-heap)
+  JAVA_TUNER_MAX_HEAP       Upper bound of the heap size (same as --max-heap)
+  JAVA_TUNER_HEADROOM       Memory left for the OS and other processes (same as --headroom)
+  JAVA_TUNER_NO_COMPRESSED_OOPS_CAP Allow heaps just above the compressed oops limit (same as --no-compressed-oops-cap)
   JAVA_TUNER_OPTS           Additional JVM flags (same as --opts)
+  JAVA_TUNER_OPTS_JSON      Additional JVM flags as a JSON array (same as --opts-json)
+  JAVA_TUNER_BLACKLIST      File with additional blacklist rules (same as --blacklist)
+  JAVA_TUNER_POLICY         File with the policy for final JVM options (same as --policy)
+  JAVA_TUNER_POLICY_MODE    Enforce the policy or only audit it (same as --policy-mode)
+  JAVA_TUNER_REMOVE_OPTS    JVM flags or patterns to remove, space-separated (same as repeated --remove-opt)
   JAVA_TUNER_NO_COLOR       Disable color output (same as --no-color)
   JAVA_TUNER_VERBOSE        Increase verbosity (same as --verbose)
   JAVA_TUNER_LOG_FORMAT     Log format to use (plain, json, console)
   JAVA_TUNER_JAVA_BIN       Path to the Java binary to use (same as --java-bin)
+  JAVA_TUNER_GC             Garbage collector to use (same as --gc)
+  JAVA_TUNER_MEMORY_CALCULATOR Calculate heap from non-heap memory needs (same as --memory-calculator)
+  JAVA_TUNER_THREAD_COUNT   Expected number of threads (same as --thread-count)
+  JAVA_TUNER_LOADED_CLASSES Expected number of loaded classes (same as --loaded-classes)
+  JAVA_TUNER_STACK_SIZE     Thread stack size (same as --stack-size)
+  JAVA_TUNER_DIRECT_MEMORY  Direct memory size (same as --direct-memory)
+  JAVA_TUNER_CODE_CACHE     Reserved code cache size (same as --code-cache)
+  JAVA_TUNER_SCAN_CLASSPATH Count classes on the classpath for memory calculator (same as --scan-classpath)
+  JAVA_TUNER_STRICT_VERSION Fail on Java versions without a tuning profile (same as --strict-version)
+  JAVA_TUNER_ON_INVALID_FLAG What to do with user options the JVM doesn't accept (same as --on-invalid-flag)
+  JAVA_TUNER_FLAGS_CACHE    Directory to cache flags supported by the JVM (same as --flags-cache)
+  JAVA_TUNER_ENV_OPTS       Policy for conflicting options in JAVA_TOOL_OPTIONS and similar (same as --env-opts)
+  JAVA_TUNER_JAVA_OPTS_ENV  Variable with JVM options used by start scripts (same as --java-opts-env)
+  JAVA_TUNER_SUPERVISE      Run Java as a supervised child process (same as --supervise)
+  JAVA_TUNER_SHUTDOWN_GRACE Grace period for the shutdown sequence of supervised Java (same as --shutdown-grace)
+  JAVA_TUNER_SHUTDOWN_JFR   File to dump a JFR recording to on slow shutdown (same as --shutdown-jfr)
+  JAVA_TUNER_RESTART        Restart policy of supervised Java (same as --restart)
+  JAVA_TUNER_RESTART_MAX_ATTEMPTS Maximum number of restarts in a row (same as --restart-max-attempts)
+  JAVA_TUNER_RESTART_BACKOFF Delay before the first restart, doubled for each next one (same as --restart-backoff)
+  JAVA_TUNER_RETRY_INVALID_OPTS Retry once without options the JVM refused to start with (same as --retry-invalid-opts)
+  JAVA_TUNER_POSTMORTEM_DIR Directory for crash files of supervised Java (same as --postmortem-dir)
+  JAVA_TUNER_POSTMORTEM_COPY_TO Directory to copy crash files to, e.g. a persistent volume (same as --postmortem-copy-to)
+  JAVA_TUNER_WRAP_OUTPUT    Log output of supervised Java as log events (same as --wrap-output)
+  JAVA_TUNER_OUTPUT_CONTINUATION Pattern of lines continuing the previous log event (same as --output-continuation)
 `,
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		switch v.GetString("log-format") {
 		case "console":
@@ -64,21 +108,6 @@ Environment Variables:
 			log.Debug().Msg("Verbose mode enabled.")
 		}
 
-		// Use tuner package to detect resources and print JVM options
-		javaVersion, cpuCount, memBytes, memPercentage, otherFlags, err := tuner.DetectResources(
-			v.GetInt("cpu-count"),
-			v.GetFloat64("mem-percentage"),
-			v.GetString("opts"))
-		if err != nil {
-			log.Error().Err(err).Msg("Failed to detect resources")
-			os.Exit(1)
-		}
-
-		opts := tuner.Tune(javaVersion, cpuCount, memBytes, memPercentage, otherFlags)
-		jvmArgs := tuner.FormatOptions(opts)
-		jvmArgs = tuner.FilterBlacklisted(jvmArgs)
-		java := runner.New().Arg(jvmArgs...).SetVerbose(flags.Verbose)
-
 		// Find arguments after -- and append them to jvmArgs
 		extraArgs := []string{}
 		for i, arg := range os.Args {
@@ -87,12 +116,74 @@ Environment Variables:
 				break
 			}
 		}
-		if len(extraArgs) > 0 {
-			java.Arg(extraArgs...)
-			log.Debug().Strs("extraArgs", extraArgs).Msg("Appended extra arguments after --")
+
+		// Use tuner package to detect resources and print JVM options
+		calculator, err := memoryCalculator()
+		if err != nil {
+			log.Error().Err(err).Msg("Invalid memory calculator settings")
+			os.Exit(1)
+		}
+
+		sizes, err := parseSizes("mem-limit", "min-heap", "max-heap", "headroom")
+		if err != nil {
+			log.Error().Err(err).Msg("Invalid memory settings")
+			os.Exit(1)
+		}
+
+		userOpts, err := userOptions()
+		if err != nil {
+			log.Error().Err(err).Msg("Invalid JVM options")
+			os.Exit(1)
+		}
+
+		blacklist := tuner.DefaultBlacklist
+		if path := v.GetString("blacklist"); path != "" {
+			rules, err := tuner.LoadBlacklist(path)
+			if err != nil {
+				log.Error().Err(err).Msg("Invalid blacklist")
+				os.Exit(1)
+			}
+			blacklist = append(rules, blacklist...)
+		}
+
+		restart, err := restartPolicy()
+		if err != nil {
+			log.Error().Err(err).Msg("Invalid restart policy")
+			os.Exit(1)
+		}
+		supervised := isSupervised()
+
+		params := tuner.Params{
+			JavaBin:             v.GetString("java-bin"),
+			CPUCount:            v.GetInt("cpu-count"),
+			MemLimit:            sizes["mem-limit"],
+			MemPercentage:       v.GetFloat64("mem-percentage"),
+			MinHeap:             sizes["min-heap"],
+			MaxHeap:             sizes["max-heap"],
+			Headroom:            sizes["headroom"],
+			NoCompressedOopsCap: v.GetBool("no-compressed-oops-cap"),
+			StrictVersion:       v.GetBool("strict-version"),
+			GC:                  v.GetString("gc"),
+			Calculator:          calculator,
+			ScanClasspath:       v.GetBool("scan-classpath"),
+			OtherFlags:          userOpts,
+			Blacklist:           blacklist,
+			Args:                extraArgs,
 		}
+		java, detected, removed, violated := prepareJava(params, adjustments{})
 
-		if !flags.DryRun {
+		if !supervised && v.GetDuration("shutdown-grace") > 0 {
+			log.Warn().Msg("Shutdown sequence works only with --supervise, ignoring --shutdown-grace")
+		}
+		if !supervised && v.GetBool("retry-invalid-opts") {
+			log.Warn().Msg("Retrying works only with --supervise, ignoring --retry-invalid-opts")
+		}
+		if !supervised && v.GetBool("wrap-output") {
+			log.Warn().Msg("Output can be wrapped only with --supervise, ignoring --wrap-output")
+		}
+		if !flags.DryRun && supervised {
+			os.Exit(supervise(params, java, restart))
+		} else if !flags.DryRun {
 			_, err := java.FindJava(v.GetString("java-bin")).Exec()
 			if err != nil {
 				log.Error().Err(err).Msg("Failed to run Java command")
@@ -100,7 +191,22 @@ Environment Variables:
 			}
 		} else {
 			log.Debug().Str("cmd", "java "+java.String()).Msg("Would run")
+			if len(removed) > 0 {
+				log.Info().Strs("removed", removed).Msg("Removed JVM options")
+			}
+			if scan := detected.ClassScan; scan != nil {
+				log.Info().
+					Strs("entries", scan.Entries).
+					Int("appClasses", scan.AppClasses).
+					Int("jdkClasses", scan.JDKClasses).
+					Int("loadedClasses", scan.Loaded).
+					Msg("Classes estimated for the memory calculator")
+			}
 			log.Info().Msg("Dry run enabled, not executing command.")
+			if violated {
+				log.Error().Msg("JVM options violate the policy")
+				os.Exit(1)
+			}
 		}
 	},
 }
@@ -134,12 +240,124 @@ func init() {
 	cmd.Flags().Float64Var(&flags.MemPercentage, "mem-percentage", 0.0, "Override detected memory percentage")
 	_ = v.BindPFlag("mem-percentage", cmd.Flags().Lookup("mem-percentage"))
 
-	cmd.Flags().StringVar(&flags.OptsRaw, "opts", "", "Additional JVM flags to pass (space-separated)")
+	cmd.Flags().StringVar(&flags.MemLimit, "mem-limit", "", "Override detected memory limit (e.g. 512Mi, 2G)")
+	_ = v.BindPFlag("mem-limit", cmd.Flags().Lookup("mem-limit"))
+
+	cmd.Flags().StringVar(&flags.MinHeap, "min-heap", "", "Lower bound of the heap size (e.g. 256Mi)")
+	_ = v.BindPFlag("min-heap", cmd.Flags().Lookup("min-heap"))
+
+	cmd.Flags().StringVar(&flags.MaxHeap, "max-heap", "", "Upper bound of the heap size (e.g. 4G)")
+	_ = v.BindPFlag("max-heap", cmd.Flags().Lookup("max-heap"))
+
+	cmd.Flags().StringVar(&flags.Headroom, "headroom", tuner.FormatSize(tuner.DefaultHeadroom), "Memory left for the OS and other processes")
+	_ = v.BindPFlag("headroom", cmd.Flags().Lookup("headroom"))
+
+	cmd.Flags().BoolVar(&flags.NoCompressedOopsCap, "no-compressed-oops-cap", false, "Don't cap heaps just above the compressed oops limit (32GB)")
+	_ = v.BindPFlag("no-compressed-oops-cap", cmd.Flags().Lookup("no-compressed-oops-cap"))
+
+	cmd.Flags().StringVar(&flags.OptsRaw, "opts", "", "Additional JVM flags to pass (space-separated, shell quoting supported)")
 	_ = v.BindPFlag("opts", cmd.Flags().Lookup("opts"))
 
+	cmd.Flags().StringVar(&flags.OptsJSON, "opts-json", "", "Additional JVM flags to pass as a JSON array, e.g. [\"-Dapp.banner=hello world\"]")
+	_ = v.BindPFlag("opts-json", cmd.Flags().Lookup("opts-json"))
+
+	cmd.Flags().StringArrayVar(&flags.Opt, "opt", nil, "Additional JVM flag to pass as is, can be repeated")
+	_ = v.BindPFlag("opt", cmd.Flags().Lookup("opt"))
+
+	cmd.Flags().StringVar(&flags.Blacklist, "blacklist", "", "YAML, JSON or TOML file with blacklist rules extending the built-in ones")
+	_ = v.BindPFlag("blacklist", cmd.Flags().Lookup("blacklist"))
+
+	cmd.Flags().StringVar(&flags.Policy, "policy", "", "YAML, JSON or TOML file with the policy for final JVM options")
+	_ = v.BindPFlag("policy", cmd.Flags().Lookup("policy"))
+
+	cmd.Flags().StringVar(&flags.PolicyMode, "policy-mode", "", "Enforce the policy or only audit it (enforce or audit, default: mode set in the policy)")
+	_ = v.BindPFlag("policy-mode", cmd.Flags().Lookup("policy-mode"))
+
+	cmd.Flags().StringArrayVar(&flags.RemoveOpt, "remove-opt", nil, "JVM flag, flag name or pattern (e.g. -XX:*StringDeduplication) to remove from the final options, can be repeated")
+	_ = v.BindPFlag("remove-opt", cmd.Flags().Lookup("remove-opt"))
+
 	cmd.Flags().StringVar(&flags.JavaBin, "java-bin", "auto-detect", "Path to the Java binary to use (default: auto-detect)")
 	_ = v.BindPFlag("java-bin", cmd.Flags().Lookup("java-bin"))
 
+	cmd.Flags().StringVar(&flags.GC, "gc", tuner.GCAuto, "Garbage collector to use (auto, serial, parallel, g1, zgc or shenandoah)")
+	_ = v.BindPFlag("gc", cmd.Flags().Lookup("gc"))
+
+	cmd.Flags().BoolVar(&flags.MemoryCalculator, "memory-calculator", false, "Calculate heap size from estimated metaspace, code cache, thread stacks and direct memory")
+	_ = v.BindPFlag("memory-calculator", cmd.Flags().Lookup("memory-calculator"))
+
+	cmd.Flags().IntVar(&flags.ThreadCount, "thread-count", tuner.DefaultThreadCount, "Expected number of threads, used by memory calculator")
+	_ = v.BindPFlag("thread-count", cmd.Flags().Lookup("thread-count"))
+
+	cmd.Flags().IntVar(&flags.LoadedClasses, "loaded-classes", 0, "Expected number of loaded classes, used by memory calculator (default: estimate)")
+	_ = v.BindPFlag("loaded-classes", cmd.Flags().Lookup("loaded-classes"))
+
+	cmd.Flags().StringVar(&flags.StackSize, "stack-size", tuner.FormatSize(tuner.DefaultStackSize), "Thread stack size, used by memory calculator")
+	_ = v.BindPFlag("stack-size", cmd.Flags().Lookup("stack-size"))
+
+	cmd.Flags().StringVar(&flags.DirectMemory, "direct-memory", tuner.FormatSize(tuner.DefaultDirectMemory), "Direct memory size, used by memory calculator")
+	_ = v.BindPFlag("direct-memory", cmd.Flags().Lookup("direct-memory"))
+
+	cmd.Flags().StringVar(&flags.CodeCache, "code-cache", tuner.FormatSize(tuner.DefaultCodeCache), "Reserved code cache size, used by memory calculator")
+	_ = v.BindPFlag("code-cache", cmd.Flags().Lookup("code-cache"))
+
+	cmd.Flags().BoolVar(&flags.ScanClasspath, "scan-classpath", true, "Count classes on the classpath when --loaded-classes is not set")
+	_ = v.BindPFlag("scan-classpath", cmd.Flags().Lookup("scan-classpath"))
+
+	cmd.Flags().BoolVar(&flags.StrictVersion, "strict-version", false, "Fail on Java versions without a tuning profile instead of using the nearest one")
+	_ = v.BindPFlag("strict-version", cmd.Flags().Lookup("strict-version"))
+
+	cmd.Flags().StringVar(&flags.OnInvalidFlag, "on-invalid-flag", tuner.OnInvalidWarn, "What to do with user options the JVM doesn't accept (drop, warn or fail), invalid generated ones are always dropped")
+	_ = v.BindPFlag("on-invalid-flag", cmd.Flags().Lookup("on-invalid-flag"))
+
+	cmd.Flags().StringVar(&flags.FlagsCache, "flags-cache", "", "Directory to cache flags supported by the JVM (default: no cache)")
+	_ = v.BindPFlag("flags-cache", cmd.Flags().Lookup("flags-cache"))
+
+	cmd.Flags().StringVar(&flags.EnvOpts, "env-opts", tuner.EnvOptsHonour, "What to do with options in JAVA_TOOL_OPTIONS, JDK_JAVA_OPTIONS and _JAVA_OPTIONS conflicting with tuned ones (honour, override or fail)")
+	_ = v.BindPFlag("env-opts", cmd.Flags().Lookup("env-opts"))
+
+	cmd.Flags().StringVar(&flags.JavaOptsEnv, "java-opts-env", "JAVA_OPTS", "Variable with JVM options used by start scripts, passed on the command line (empty to ignore)")
+	_ = v.BindPFlag("java-opts-env", cmd.Flags().Lookup("java-opts-env"))
+
+	cmd.Flags().BoolVar(&flags.Supervise, "supervise", false, "Run Java as a child process, forwarding signals, reaping zombies and propagating its exit code, instead of replacing java-tuner")
+	_ = v.BindPFlag("supervise", cmd.Flags().Lookup("supervise"))
+
+	cmd.Flags().DurationVar(&flags.ShutdownGrace, "shutdown-grace", 0, "Grace period given by the orchestrator, e.g. 30s, supervised Java gets a thread dump in the half of it and is killed at 90% (default: disabled)")
+	_ = v.BindPFlag("shutdown-grace", cmd.Flags().Lookup("shutdown-grace"))
+
+	cmd.Flags().StringVar(&flags.ShutdownJFR, "shutdown-jfr", "", "File to dump a running JFR recording to, along with the thread dump on slow shutdown")
+	_ = v.BindPFlag("shutdown-jfr", cmd.Flags().Lookup("shutdown-jfr"))
+
+	cmd.Flags().StringVar(&flags.Restart, "restart", runner.RestartNever, "Restart policy of Java, implies --supervise (never, on-failure or always)")
+	_ = v.BindPFlag("restart", cmd.Flags().Lookup("restart"))
+
+	cmd.Flags().IntVar(&flags.RestartMaxAttempts, "restart-max-attempts", 5, "Maximum number of restarts in a row, 0 for no limit")
+	_ = v.BindPFlag("restart-max-attempts", cmd.Flags().Lookup("restart-max-attempts"))
+
+	cmd.Flags().DurationVar(&flags.RestartBackoff, "restart-backoff", time.Second, "Delay before the first restart, doubled for each next one, up to 5m")
+	_ = v.BindPFlag("restart-backoff", cmd.Flags().Lookup("restart-backoff"))
+
+	cmd.Flags().BoolVar(&flags.RetryInvalidOpts, "retry-invalid-opts", false, "In supervisor mode, retry once without options the JVM refused to start with, e.g. removed in a newer Java")
+	_ = v.BindPFlag("retry-invalid-opts", cmd.Flags().Lookup("retry-invalid-opts"))
+
+	cmd.Flags().StringVar(&flags.PostMortemDir, "postmortem-dir", filepath.Join(os.TempDir(), "java-tuner"), "In supervisor mode, directory for hs_err, replay and heap dump files of Java, unless set in JVM options (empty to disable)")
+	_ = v.BindPFlag("postmortem-dir", cmd.Flags().Lookup("postmortem-dir"))
+
+	cmd.Flags().StringVar(&flags.PostMortemCopyTo, "postmortem-copy-to", "", "In supervisor mode, directory to copy crash files to after Java dies, e.g. a persistent volume")
+	_ = v.BindPFlag("postmortem-copy-to", cmd.Flags().Lookup("postmortem-copy-to"))
+
+	cmd.Flags().BoolVar(&flags.WrapOutput, "wrap-output", false, "In supervisor mode, log each line of Java output as a log event, e.g. JSON with --log-format json")
+	_ = v.BindPFlag("wrap-output", cmd.Flags().Lookup("wrap-output"))
+
+	cmd.Flags().StringVar(&flags.OutputContinuation, "output-continuation", runner.DefaultContinuation, "Regular expression matching lines, that continue the previous log event, like stack trace frames")
+	_ = v.BindPFlag("output-continuation", cmd.Flags().Lookup("output-continuation"))
+
+	profilesCmd.AddCommand(profilesListCmd)
+	cmd.AddCommand(profilesCmd)
+
+	migrateCmd.Flags().StringVar(&migrateFrom, "from", "8", "Java version the options were used with")
+	migrateCmd.Flags().StringVar(&migrateTo, "to", "21", "Java version to migrate the options to")
+	cmd.AddCommand(migrateCmd)
+
 	v.AutomaticEnv()
 }
 
@@ -150,10 +368,15 @@ func main() {
 	}
 }
 
+// logOutput is where the logger writes to, stderr is the default of zerolog
+// used with --log-format json.
+var logOutput io.Writer = os.Stderr
+
 func initLogger(verbose bool, noColor bool) {
+	logOutput = colorable.NewColorableStdout()
 	// Console writer
 	consoleWriter := zerolog.ConsoleWriter{
-		Out:     colorable.NewColorableStdout(),
+		Out:     logOutput,
 		NoColor: noColor,
 	}
 	// Disable timestamps
@@ -177,6 +400,413 @@ func initLogger(verbose bool, noColor bool) {
 	}
 }
 
+func memoryCalculator() (tuner.MemoryCalculator, error) {
+	sizes, err := parseSizes("stack-size", "direct-memory", "code-cache")
+	return tuner.MemoryCalculator{
+		Enabled:      v.GetBool("memory-calculator"),
+		ThreadCount:  v.GetInt("thread-count"),
+		ClassCount:   v.GetInt("loaded-classes"),
+		StackSize:    sizes["stack-size"],
+		DirectMemory: sizes["direct-memory"],
+		CodeCache:    sizes["code-cache"],
+	}, err
+}
+
+// parseSizes parses human readable sizes of given settings, empty ones
+// are returned as 0.
+func parseSizes(keys ...string) (map[string]uint64, error) {
+	sizes := map[string]uint64{}
+	for _, key := range keys {
+		if v.GetString(key) == "" {
+			continue
+		}
+		size, err := tuner.ParseSize(v.GetString(key))
+		if err != nil {
+			return sizes, fmt.Errorf("--%s: %w", key, err)
+		}
+		sizes[key] = size
+	}
+	return sizes, nil
+}
+
+// userOptions collects JVM options from --opts, --opts-json and --opt,
+// in this order.
+func userOptions() ([]string, error) {
+	opts, err := tuner.SplitOpts(v.GetString("opts"))
+	if err != nil {
+		return nil, fmt.Errorf("--opts: %w", err)
+	}
+	if raw := v.GetString("opts-json"); raw != "" {
+		var jsonOpts []string
+		if err := json.Unmarshal([]byte(raw), &jsonOpts); err != nil {
+			return nil, fmt.Errorf("--opts-json: %w", err)
+		}
+		opts = append(opts, jsonOpts...)
+	}
+	return append(opts, v.GetStringSlice("opt")...), nil
+}
+
+// removePatterns collects patterns of options to remove from
+// JAVA_TUNER_REMOVE_OPTS and --remove-opt.
+func removePatterns() ([]string, error) {
+	patterns, err := tuner.SplitOpts(v.GetString("remove-opts"))
+	if err != nil {
+		return nil, fmt.Errorf("%s_REMOVE_OPTS: %w", getPrefix(), err)
+	}
+	return append(patterns, v.GetStringSlice("remove-opt")...), nil
+}
+
+// adjustments are changes to tuning learned from previous runs of Java.
+type adjustments struct {
+	oomKills    int      // exits caused by the OOM killer
+	invalidOpts []string // options the JVM refused to start with
+}
+
+// prepareJava detects resources and tunes JVM options, returning the Java
+// command, detected params, removed options and if the policy was violated.
+// It's run again before each restart, so the options follow the current
+// resources and the adjustments.
+func prepareJava(params tuner.Params, adjust adjustments) (*runner.Cmd, tuner.Params, []string, bool) {
+	params, err := tuner.DetectResources(params)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to detect resources")
+		os.Exit(1)
+	}
+	params = tuner.ReduceHeap(params, adjust.oomKills)
+
+	opts, err := tuner.Tune(params)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to tune JVM options")
+		os.Exit(1)
+	}
+	removePatterns, err := removePatterns()
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid options to remove")
+		os.Exit(1)
+	}
+	postMortemDir := ""
+	if dir := v.GetString("postmortem-dir"); dir != "" && isSupervised() {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Warn().Err(err).Str("dir", dir).Msg("Could not create post-mortem directory, JVM crash files stay in default locations")
+		} else {
+			postMortemDir = dir
+		}
+	}
+	jvmArgs, removed, err := tuner.FinalOptions(opts, params.JavaVersion, postMortemDir, validateOptions, append(removePatterns, adjust.invalidOpts...))
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid JVM options")
+		os.Exit(1)
+	}
+	envOpts, err := resolveEnvOptions(jvmArgs)
+	if err != nil {
+		log.Error().Err(err).Msg("JVM options in environment conflict with tuned ones")
+		os.Exit(1)
+	}
+	environ := envOpts.ApplyEnv(os.Environ())
+	java := runner.New().Arg(envOpts.Args...).SetEnv(environ).SetVerbose(flags.Verbose)
+	for name, value := range envOpts.Env {
+		log.Info().Str("name", name).Str("value", value).Msg("Rewrote JVM options in environment of Java process")
+	}
+
+	violated, enforced, err := checkPolicy(tuner.EffectiveOptions(envOpts.Args, environ), params.MemLimit)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid policy")
+		os.Exit(1)
+	}
+	if violated && enforced && !flags.DryRun {
+		log.Error().Msg("JVM options violate the policy, not starting Java")
+		os.Exit(1)
+	}
+
+	if len(params.Args) > 0 {
+		java.Arg(params.Args...)
+		log.Debug().Strs("extraArgs", params.Args).Msg("Appended extra arguments after --")
+	}
+	return java, params, removed, violated
+}
+
+// supervise runs Java as a child process, restarting it according to the
+// restart policy, and returns the exit code to propagate.
+func supervise(params tuner.Params, java *runner.Cmd, restart runner.RestartPolicy) int {
+	continuation, err := outputContinuation()
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid output settings")
+		return 1
+	}
+	adjust := adjustments{}
+	retried := false
+	for attempt := 1; ; attempt++ {
+		var stdout, stderr io.Writer
+		var wrapped []*runner.LogWriter
+		if continuation != nil {
+			wrapped = []*runner.LogWriter{
+				runner.NewLogWriter("stdout", java.Pid, continuation, logOutput),
+				runner.NewLogWriter("stderr", java.Pid, continuation, logOutput),
+			}
+			stdout, stderr = wrapped[0], wrapped[1]
+		}
+		startup := &headBuffer{limit: startupOutputLimit}
+		if v.GetBool("retry-invalid-opts") && !retried {
+			if stderr == nil {
+				stderr = os.Stderr
+			}
+			stderr = io.MultiWriter(stderr, startup)
+		}
+		java.SetOutput(stdout, stderr)
+
+		started := time.Now()
+		status, err := java.FindJava(v.GetString("java-bin")).SetShutdown(shutdownSequence()).Supervise()
+		for _, w := range wrapped {
+			w.Flush()
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to run Java command")
+			return 1
+		}
+		uptime := time.Since(started)
+		event := log.Info().Int("code", status.ExitCode()).Str("cause", status.Cause()).Stringer("uptime", uptime.Round(time.Millisecond))
+		if status.Signal != 0 {
+			event.Str("signal", status.Signal.String())
+		}
+		event.Msg("Java process exited")
+		if cause := status.Cause(); cause != runner.ExitNormal && cause != runner.ExitStopped {
+			postMortem(java, status, started)
+		}
+
+		if invalid := tuner.InvalidOptions(startup.String(), java.Args()); len(invalid) > 0 && !status.Stopped {
+			retried = true
+			for _, opt := range invalid {
+				log.Warn().Str("option", opt).Msg("JVM refused to start with option " + opt + ", retrying without it. Remove it from the configuration")
+			}
+			adjust.invalidOpts = append(adjust.invalidOpts, invalid...)
+			java, _, _, _ = prepareJava(params, adjust)
+			attempt--
+			continue
+		}
+
+		if uptime >= runner.RestartResetAfter {
+			attempt = 1
+		}
+		if !restart.Restarts(status) {
+			return status.ExitCode()
+		}
+		delay, ok := restart.Delay(attempt)
+		if !ok {
+			log.Error().Int("attempts", restart.MaxAttempts).Msg("Java keeps exiting, giving up restarts")
+			return status.ExitCode()
+		}
+		if status.Cause() == runner.ExitOOMKilled {
+			adjust.oomKills++
+		}
+		log.Warn().Int("attempt", attempt).Str("cause", status.Cause()).Stringer("delay", delay).Msg("Restarting Java")
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+		select {
+		case sig := <-stop:
+			signal.Stop(stop)
+			log.Info().Str("signal", sig.String()).Msg("Stopped while waiting to restart Java")
+			return status.ExitCode()
+		case <-time.After(delay):
+			signal.Stop(stop)
+		}
+		java, _, _, _ = prepareJava(params, adjust)
+	}
+}
+
+// postMortem logs a summary of the exit of Java with files it left, and
+// copies them to --postmortem-copy-to, if set.
+func postMortem(java *runner.Cmd, status runner.ExitStatus, started time.Time) {
+	pid := java.Pid()
+	files := tuner.CrashFilesOf(java.Args()).Find(pid, started)
+	event := log.Error().
+		Int("pid", pid).
+		Int("code", status.ExitCode()).
+		Str("cause", status.Cause()).
+		Str("description", status.Describe()).
+		Strs("files", files)
+	for _, path := range files {
+		if !strings.Contains(filepath.Base(path), "hs_err") {
+			continue
+		}
+		report, err := tuner.ParseErrorFile(path)
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not parse JVM error file")
+			continue
+		}
+		event.Str("error", report.Error).
+			Str("problematicFrame", report.ProblematicFrame).
+			Str("jreVersion", report.JREVersion).
+			Str("javaVM", report.JavaVM).
+			Str("memory", report.Memory).
+			Str("heap", report.Heap)
+	}
+	event.Msg("Java post-mortem")
+
+	if dir := v.GetString("postmortem-copy-to"); dir != "" && len(files) > 0 {
+		target, err := tuner.CopyCrashFiles(files, dir, pid)
+		if err != nil {
+			log.Error().Err(err).Str("dir", dir).Msg("Could not copy JVM crash files")
+			return
+		}
+		log.Info().Str("dir", target).Msg("Copied JVM crash files")
+	}
+}
+
+// outputContinuation returns the pattern of lines continuing a log event,
+// when output of Java is wrapped into log events, or nil.
+func outputContinuation() (*regexp.Regexp, error) {
+	if !v.GetBool("wrap-output") {
+		return nil, nil
+	}
+	re, err := regexp.Compile(v.GetString("output-continuation"))
+	if err != nil {
+		return nil, fmt.Errorf("--output-continuation: %w", err)
+	}
+	return re, nil
+}
+
+// isSupervised reports if Java runs as a child of java-tuner.
+func isSupervised() bool {
+	return v.GetBool("supervise") || v.GetString("restart") != runner.RestartNever
+}
+
+// startupOutputLimit is how much of the error output of Java is kept to
+// find options, that it refused to start with.
+const startupOutputLimit = 64 * 1024
+
+// headBuffer keeps the beginning of the output, up to the limit.
+type headBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// restartPolicy reads the restart policy of supervised Java.
+func restartPolicy() (runner.RestartPolicy, error) {
+	policy := runner.RestartPolicy{
+		Mode:        v.GetString("restart"),
+		MaxAttempts: v.GetInt("restart-max-attempts"),
+		Backoff:     v.GetDuration("restart-backoff"),
+	}
+	switch policy.Mode {
+	case runner.RestartNever, runner.RestartOnFailure, runner.RestartAlways:
+	default:
+		return policy, fmt.Errorf("--restart: unknown value %q, use never, on-failure or always", policy.Mode)
+	}
+	if policy.MaxAttempts < 0 {
+		return policy, fmt.Errorf("--restart-max-attempts: must not be negative, got %d", policy.MaxAttempts)
+	}
+	return policy, nil
+}
+
+// shutdownSequence returns the stop sequence of supervised Java, derived
+// from --shutdown-grace.
+func shutdownSequence() runner.Shutdown {
+	shutdown := runner.NewShutdown(v.GetDuration("shutdown-grace"))
+	if jfr := v.GetString("shutdown-jfr"); jfr != "" {
+		shutdown.OnThreadDump = func(pid int) {
+			java, err := runner.LookJava(v.GetString("java-bin"))
+			if err == nil {
+				java, err = filepath.EvalSymlinks(java)
+			}
+			if err != nil {
+				log.Warn().Err(err).Msg("Could not find jcmd to dump JFR recording")
+				return
+			}
+			jcmd := filepath.Join(filepath.Dir(java), "jcmd")
+			out, err := runner.New(jcmd).Arg(strconv.Itoa(pid), "JFR.dump", "filename="+jfr).Output()
+			if err != nil {
+				log.Warn().Err(err).Str("output", out).Msg("Could not dump JFR recording")
+				return
+			}
+			log.Info().Str("file", jfr).Msg("Dumped JFR recording")
+		}
+	}
+	return shutdown
+}
+
+// checkPolicy evaluates the final JVM options, including the ones read by
+// the JVM from environment, against the policy, if it's set, and logs
+// violations. It reports if the policy was violated and if it's enforced.
+func checkPolicy(opts []string, memLimit uint64) (bool, bool, error) {
+	path := v.GetString("policy")
+	if path == "" {
+		return false, false, nil
+	}
+	policy, err := tuner.LoadPolicy(path)
+	if err != nil {
+		return false, false, err
+	}
+	if mode := v.GetString("policy-mode"); mode != "" {
+		if mode != tuner.PolicyEnforce && mode != tuner.PolicyAudit {
+			return false, false, fmt.Errorf("--policy-mode: unknown value %q, use enforce or audit", mode)
+		}
+		policy.Mode = mode
+	}
+
+	enforced := policy.Mode == tuner.PolicyEnforce
+	violations := policy.Evaluate(opts, memLimit)
+	for _, violation := range violations {
+		event := log.Warn()
+		if enforced {
+			event = log.Error()
+		}
+		event.Str("option", violation.Option).Str("mode", policy.Mode).Msg("Policy violation: " + violation.Error())
+	}
+	if len(violations) == 0 {
+		log.Debug().Str("file", path).Msg("JVM options comply with the policy")
+	}
+	return len(violations) > 0, enforced, nil
+}
+
+// resolveEnvOptions resolves conflicts between the options and the ones
+// set in the environment for Java.
+func resolveEnvOptions(opts []string) (tuner.EnvResolution, error) {
+	policy := v.GetString("env-opts")
+	switch policy {
+	case tuner.EnvOptsHonour, tuner.EnvOptsOverride, tuner.EnvOptsFail:
+	default:
+		return tuner.EnvResolution{}, fmt.Errorf("--env-opts: unknown value %q, use honour, override or fail", policy)
+	}
+	return tuner.ResolveEnvOptions(opts, tuner.ReadEnvOptions(os.Getenv, v.GetString("java-opts-env")), policy)
+}
+
+// validateOptions checks options against flags supported by the JVM. It's
+// skipped when the flags can't be listed, or when there are no user options
+// and no cache, not to start the JVM once more only to check the generated
+// ones.
+func validateOptions(opts, userOpts []string) ([]string, error) {
+	onInvalid := v.GetString("on-invalid-flag")
+	switch onInvalid {
+	case tuner.OnInvalidDrop, tuner.OnInvalidWarn, tuner.OnInvalidFail:
+	default:
+		return opts, fmt.Errorf("--on-invalid-flag: unknown value %q, use drop, warn or fail", onInvalid)
+	}
+	if len(userOpts) == 0 && v.GetString("flags-cache") == "" {
+		log.Debug().Msg("No user options to validate, skipping validation of JVM options")
+		return opts, nil
+	}
+
+	javaBin, err := runner.LookJava(v.GetString("java-bin"))
+	if err != nil {
+		log.Warn().Err(err).Msg("Java executable not found, skipping validation of JVM options")
+		return opts, nil
+	}
+	jvmFlags, err := tuner.LoadJVMFlags(javaBin, v.GetString("flags-cache"))
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not list JVM flags, skipping validation of JVM options")
+		return opts, nil
+	}
+	return tuner.ValidateOptions(opts, userOpts, jvmFlags, onInvalid)
+}
+
 func getPrefix() string {
 	fallback := JAVA_TUNER_DEFAULT_PREFIX
 	prefix := os.Getenv("JAVA_TUNER_PREFIX")
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+var migrateFrom, migrateTo string
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate [--from version] [--to version] -- <jvm options>",
+	Short: "Preview migration of obsolete JVM options to a newer Java version",
+	Long: `Preview migration of obsolete JVM options to a newer Java version.
+
+Options removed or changed between the versions are translated into their
+modern equivalents, no-ops are dropped and options without a replacement
+make the command fail. The same migration is applied to --opts when running
+Java.`,
+	SilenceUsage: true,
+	Example:      "  java-tuner migrate --from 8 --to 21 -- -XX:+UseConcMarkSweepGC -Xloggc:/var/log/gc.log",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// migration logs would only clutter the preview
+		log.Logger = zerolog.Nop()
+
+		from, to := tuner.MajorVersion(migrateFrom), tuner.MajorVersion(migrateTo)
+		opts, changes, err := tuner.MigrateOptions(args, to)
+
+		out := cmd.OutOrStdout()
+		_, oldChanges, _ := tuner.MigrateOptions(args, from)
+		for _, change := range changes {
+			note := ""
+			for _, old := range oldChanges {
+				if old.Option == change.Option {
+					note = fmt.Sprintf(", already obsolete in Java %s", migrateFrom)
+				}
+			}
+			switch change.Action {
+			case tuner.MigrateTranslate:
+				fmt.Fprintf(out, "%s -> %s (%s%s)\n", change.Option, change.Replacement, change.Reason, note)
+			case tuner.MigrateDrop:
+				fmt.Fprintf(out, "%s dropped (%s%s)\n", change.Option, change.Reason, note)
+			default:
+				fmt.Fprintf(out, "%s can't be migrated (%s%s)\n", change.Option, change.Reason, note)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			fmt.Fprintf(out, "No changes needed for Java %s\n", migrateTo)
+		}
+		fmt.Fprintln(out, strings.Join(opts, " "))
+		return nil
+	},
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+// Resources of the example container used to show what profiles emit.
+const (
+	exampleCPUCount = 2
+	exampleMemLimit = 1 * tuner.GiB
+)
+
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "Inspect tuning profiles for supported Java versions",
+}
+
+var profilesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List Java version ranges and the JVM options emitted for them",
+	Long: fmt.Sprintf(`List Java version ranges and the JVM options emitted for them.
+
+Options are shown for an example container with %d CPUs and %s of memory.
+Versions outside of all ranges use the nearest profile, unless --strict-version is set.`,
+		exampleCPUCount, tuner.FormatSize(exampleMemLimit)),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// tuning logs would only clutter the listing
+		log.Logger = zerolog.Nop()
+
+		for _, profile := range tuner.Defaults {
+			percentage, _ := profile.RAMPercentage(exampleMemLimit)
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   profile.MinVersion(),
+				Vendor:        tuner.VendorUnknown,
+				CPUCount:      exampleCPUCount,
+				CPUQuota:      exampleCPUCount,
+				MemLimit:      exampleMemLimit,
+				MemPercentage: percentage,
+			})
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", profile.Range(), err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s\n  %s\n", profile.Range(), strings.Join(tuner.FormatOptions(opts), " "))
+		}
+		return nil
+	},
+}
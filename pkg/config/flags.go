@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type Flags struct {
 	DryRun        bool
 	NoColor       bool
@@ -9,8 +11,44 @@ type Flags struct {
 	LogFormat     string
 	CPUCount      int
 	MemPercentage float64
-	MemLimit      uint64
-	JvmOpts       []string
-	OptsRaw       string
-	JavaBin       string
+	MemLimit      string
+	MinHeap       string
+	MaxHeap       string
+	Headroom      string
+
+	NoCompressedOopsCap bool
+	JvmOpts             []string
+	OptsRaw             string
+	OptsJSON            string
+	Opt                 []string
+	RemoveOpt           []string
+	Blacklist           string
+	Policy              string
+	PolicyMode          string
+	JavaBin             string
+	GC                  string
+	StrictVersion       bool
+	OnInvalidFlag       string
+	FlagsCache          string
+	EnvOpts             string
+	JavaOptsEnv         string
+	Supervise           bool
+	ShutdownGrace       time.Duration
+	ShutdownJFR         string
+	Restart             string
+	RestartMaxAttempts  int
+	RestartBackoff      time.Duration
+	RetryInvalidOpts    bool
+	PostMortemDir       string
+	PostMortemCopyTo    string
+	WrapOutput          bool
+	OutputContinuation  string
+
+	MemoryCalculator bool
+	ThreadCount      int
+	LoadedClasses    int
+	StackSize        string
+	DirectMemory     string
+	CodeCache        string
+	ScanClasspath    bool
 }
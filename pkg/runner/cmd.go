@@ -21,6 +21,11 @@ type Cmd struct {
 	preText  string
 	postText string
 	output   string
+	env      []string // nil means environment of the current process
+	shutdown Shutdown
+	stdout   io.Writer // of a supervised process, nil means os.Stdout
+	stderr   io.Writer // of a supervised process, nil means os.Stderr
+	pid      int       // of the last supervised process
 }
 
 func New(c ...string) *Cmd {
@@ -46,27 +51,33 @@ func (c *Cmd) SetCommand(cmd string) *Cmd {
 }
 
 func (c *Cmd) FindJava(defaultPath string) *Cmd {
+	path, err := LookJava(defaultPath)
+	if err != nil {
+		log.Error().Err(err).Str("path", defaultPath).Msg("Java executable not found")
+		os.Exit(1)
+	}
 	if defaultPath == "" || defaultPath == "auto-detect" {
-		path, err := exec.LookPath("java")
-		if err != nil {
-			log.Error().Err(err).Msg("Java executable not found")
-			os.Exit(1)
-		} else {
-			log.Info().Str("path", path).Msg("Java executable found")
-		}
-
-		c.cmd = path
+		log.Info().Str("path", path).Msg("Java executable found")
 	} else {
-		if _, err := os.Stat(defaultPath); os.IsNotExist(err) {
-			log.Error().Str("path", defaultPath).Msg("Java executable not found at specified path")
-			os.Exit(1)
-		}
-		c.cmd = defaultPath
-		log.Info().Str("path", c.cmd).Msg("Using specified Java executable")
+		log.Info().Str("path", path).Msg("Using specified Java executable")
 	}
+
+	c.cmd = path
 	return c
 }
 
+// LookJava returns path to the Java executable, searching PATH when
+// defaultPath is not set or set to "auto-detect".
+func LookJava(defaultPath string) (string, error) {
+	if defaultPath == "" || defaultPath == "auto-detect" {
+		return exec.LookPath("java")
+	}
+	if _, err := os.Stat(defaultPath); err != nil {
+		return "", err
+	}
+	return defaultPath, nil
+}
+
 func (c *Cmd) Equal(cmd *Cmd) bool {
 	return c.String() == cmd.String()
 }
@@ -76,6 +87,24 @@ func (c *Cmd) Arg(args ...string) *Cmd {
 	return c
 }
 
+// SetEnv sets the environment of the command, in the form of os.Environ().
+func (c *Cmd) SetEnv(env []string) *Cmd {
+	c.env = env
+	return c
+}
+
+func (c *Cmd) environ() []string {
+	if c.env == nil {
+		return os.Environ()
+	}
+	return c.env
+}
+
+// Args returns arguments of the command.
+func (c *Cmd) Args() []string {
+	return c.args
+}
+
 func (c *Cmd) SetVerbose(verbosity bool) *Cmd {
 	c.verbose = verbosity
 	return c
@@ -104,7 +133,7 @@ func (c *Cmd) Exec() (string, error) {
 
 	// Prepare argv: first arg is the command itself
 	argv := append([]string{c.cmd}, c.args...)
-	env := os.Environ()
+	env := c.environ()
 
 	// Use syscall.Exec to replace the current process
 	// Note: This call does not return if successful
@@ -126,6 +155,7 @@ func (c *Cmd) Run() (string, error) {
 	}
 
 	cmd := exec.CommandContext(ctx, c.cmd, c.args...)
+	cmd.Env = c.environ()
 
 	// pipe the commands output to the applications
 	var b bytes.Buffer
@@ -138,7 +168,9 @@ func (c *Cmd) Run() (string, error) {
 	}
 
 	log.Debug().Str("cmd", c.cmd).Interface("args", c.args).Msg("Running")
+	children.RLock()
 	err := cmd.Run()
+	children.RUnlock()
 
 	// Check for context cancellation or timeout
 	if ctx.Err() != nil {
@@ -173,6 +205,7 @@ func (c *Cmd) String() string {
 
 func (c *Cmd) Output() (string, error) {
 	cmd := exec.Command(c.cmd, c.args...)
+	cmd.Env = c.environ()
 
 	// pipe the commands output to the applications
 	var b bytes.Buffer
@@ -186,7 +219,9 @@ func (c *Cmd) Output() (string, error) {
 	}
 
 	log.Debug().Str("cmd", c.cmd).Interface("args", c.args).Msg("Running")
+	children.RLock()
 	err := cmd.Run()
+	children.RUnlock()
 
 	// Handle other errors
 	if err != nil {
@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultContinuation matches lines continuing the previous log event, like
+// frames and causes of Java stack traces.
+const DefaultContinuation = `^(\s+\S|Caused by: |Suppressed: )`
+
+// logEventIdle is how long a multi-line event waits for continuation lines.
+// An unfinished line is not logged after it, the rest might still come.
+const logEventIdle = 100 * time.Millisecond
+
+// logEventMaxLines limits lines grouped into one event.
+const logEventMaxLines = 1000
+
+// LogWriter turns output of a supervised process into log events, one per
+// line. Lines matching the continuation pattern, e.g. stack traces, are
+// grouped with the previous line. Lines, that are already JSON, are written
+// to raw as they are, it should be the output of the logger, so they keep
+// their order with the events.
+type LogWriter struct {
+	stream       string
+	pid          func() int
+	continuation *regexp.Regexp
+	raw          io.Writer
+
+	mu      sync.Mutex
+	partial []byte
+	lines   []string
+	started time.Time // when the first line of the event was read
+	timer   *time.Timer
+}
+
+// NewLogWriter creates a writer logging output of the stream of the process
+// with pid.
+func NewLogWriter(stream string, pid func() int, continuation *regexp.Regexp, raw io.Writer) *LogWriter {
+	return &LogWriter{stream: stream, pid: pid, continuation: continuation, raw: raw}
+}
+
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(strings.TrimSuffix(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+	if len(w.lines) > 0 {
+		if w.timer == nil {
+			w.timer = time.AfterFunc(logEventIdle, w.idle)
+		} else {
+			w.timer.Reset(logEventIdle)
+		}
+	}
+	return len(p), nil
+}
+
+// idle logs the pending event, once no continuation line came in time.
+func (w *LogWriter) idle() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.emit()
+}
+
+// Flush logs the pending event and the last unfinished line. Call it once
+// the stream is closed.
+func (w *LogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		w.line(string(w.partial))
+		w.partial = nil
+	}
+	w.emit()
+}
+
+func (w *LogWriter) line(line string) {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "":
+		return
+	case strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)):
+		w.emit()
+		if _, err := io.WriteString(w.raw, trimmed+"\n"); err != nil {
+			log.Debug().Err(err).Str("stream", w.stream).Msg("Could not pass through JSON output")
+		}
+		return
+	case len(w.lines) > 0 && len(w.lines) < logEventMaxLines && w.continuation != nil && w.continuation.MatchString(line):
+		w.lines = append(w.lines, line)
+		return
+	}
+	w.emit()
+	w.lines = []string{line}
+	w.started = time.Now()
+}
+
+// emit logs the pending event, mu has to be held.
+func (w *LogWriter) emit() {
+	if len(w.lines) == 0 {
+		return
+	}
+	log.Info().
+		Str("stream", w.stream).
+		Int("pid", w.pid()).
+		Str("timestamp", w.started.Format(time.RFC3339Nano)). // not affected by zerolog.TimeFieldFormat
+		Msg(strings.Join(w.lines, "\n"))
+	w.lines = nil
+}
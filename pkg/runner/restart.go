@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// Restart policies of a supervised process.
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure" // restart after non-zero exits and crashes
+	RestartAlways    = "always"     // restart after any exit, unless stopped
+)
+
+// Causes of the exit of a supervised process.
+const (
+	ExitNormal      = "normal"        // exit code 0
+	ExitFailure     = "failure"       // other exit codes
+	ExitOutOfMemory = "out-of-memory" // exit code 3 of -XX:+ExitOnOutOfMemoryError
+	ExitOOMKilled   = "oom-killed"    // SIGKILL, most likely sent by the OOM killer
+	ExitCrash       = "crash"         // SIGABRT, SIGSEGV and similar, JVM crashed
+	ExitStopped     = "stopped"       // the supervisor was asked to stop it
+)
+
+// MaxRestartBackoff caps the exponential backoff between restarts.
+const MaxRestartBackoff = 5 * time.Minute
+
+// RestartResetAfter is how long a process has to run, for the next restart
+// to be counted as the first one again.
+const RestartResetAfter = 10 * time.Minute
+
+// Cause classifies the exit. Exit codes above 128 are treated as signals,
+// as reported by shells wrapping Java.
+func (s ExitStatus) Cause() string {
+	sig := s.Signal
+	if sig == 0 && s.Code > 128 && s.Code < 128+65 {
+		sig = syscall.Signal(s.Code - 128)
+	}
+	switch {
+	case s.Stopped:
+		return ExitStopped
+	case sig == syscall.SIGKILL:
+		return ExitOOMKilled
+	case sig == syscall.SIGABRT, sig == syscall.SIGSEGV, sig == syscall.SIGBUS, sig == syscall.SIGILL, sig == syscall.SIGFPE:
+		return ExitCrash
+	case sig == 0 && s.Code == 0:
+		return ExitNormal
+	case sig == 0 && s.Code == 3:
+		return ExitOutOfMemory
+	}
+	return ExitFailure
+}
+
+// signalNames are names of signals, that usually end a JVM.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGTERM: "SIGTERM",
+}
+
+// Describe translates the exit code into a human readable explanation.
+func (s ExitStatus) Describe() string {
+	code := s.ExitCode()
+	name := ""
+	if sig := syscall.Signal(code - 128); code > 128 {
+		name = signalNames[sig]
+		if name == "" {
+			name = "signal " + sig.String()
+		}
+	}
+	switch s.Cause() {
+	case ExitNormal:
+		return "exited normally"
+	case ExitStopped:
+		return fmt.Sprintf("%d: stopped on request", code)
+	case ExitOutOfMemory:
+		return "3: Java heap exhausted, exited by -XX:+ExitOnOutOfMemoryError"
+	case ExitOOMKilled:
+		return fmt.Sprintf("%d: %s, probably killed by the OOM killer, the memory limit is too low", code, name)
+	case ExitCrash:
+		return fmt.Sprintf("%d: %s, the JVM crashed", code, name)
+	}
+	if name != "" {
+		return fmt.Sprintf("%d: killed by %s", code, name)
+	}
+	return fmt.Sprintf("%d: exited with an error", code)
+}
+
+// RestartPolicy decides if and when a supervised process is restarted.
+type RestartPolicy struct {
+	Mode        string
+	MaxAttempts int           // 0 means no limit
+	Backoff     time.Duration // delay of the first restart, doubled for each next one
+}
+
+// Restarts reports if the process should be restarted after the exit.
+func (p RestartPolicy) Restarts(status ExitStatus) bool {
+	switch cause := status.Cause(); {
+	case cause == ExitStopped:
+		return false
+	case p.Mode == RestartOnFailure:
+		return cause != ExitNormal
+	}
+	return p.Mode == RestartAlways
+}
+
+// Delay returns the delay before the given restart attempt, counted from 1,
+// or false when there are no attempts left.
+func (p RestartPolicy) Delay(attempt int) (time.Duration, bool) {
+	if p.MaxAttempts > 0 && attempt > p.MaxAttempts {
+		return 0, false
+	}
+	delay := p.Backoff
+	for i := 1; i < attempt && delay < MaxRestartBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxRestartBackoff), true
+}
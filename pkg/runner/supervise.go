@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ExitStatus is how the supervised process finished.
+type ExitStatus struct {
+	Code   int
+	Signal syscall.Signal // set, when killed by a signal
+	// Stopped is set, when the process was asked to stop with SIGTERM,
+	// SIGINT or SIGHUP received by the supervisor
+	Stopped bool
+}
+
+// ExitCode returns the exit code to propagate, for signals it's 128 plus the
+// signal number, same as in a shell, tini or dumb-init.
+func (s ExitStatus) ExitCode() int {
+	if s.Signal != 0 {
+		return 128 + int(s.Signal)
+	}
+	return s.Code
+}
+
+// Shutdown is the stop sequence of a supervised process. After SIGTERM or
+// SIGINT is forwarded, SIGQUIT is sent after ThreadDumpAfter, so the JVM
+// prints a thread dump, and the process group is killed after KillAfter.
+// OnThreadDump, if set, is called along with SIGQUIT, e.g. to dump JFR.
+type Shutdown struct {
+	ThreadDumpAfter time.Duration
+	KillAfter       time.Duration
+	OnThreadDump    func(pid int)
+}
+
+// NewShutdown derives the stop sequence from the grace period given by the
+// orchestrator: thread dump in the half of it, kill at 90%, before the
+// external SIGKILL arrives. Zero grace disables the sequence.
+func NewShutdown(grace time.Duration) Shutdown {
+	return Shutdown{ThreadDumpAfter: grace / 2, KillAfter: grace * 9 / 10}
+}
+
+func (s Shutdown) enabled() bool {
+	return s.KillAfter > 0
+}
+
+// SetOutput redirects stdout and stderr of a supervised process, nil keeps
+// writing to the ones of java-tuner.
+func (c *Cmd) SetOutput(stdout, stderr io.Writer) *Cmd {
+	c.stdout, c.stderr = stdout, stderr
+	return c
+}
+
+// Pid returns the process ID of the last supervised process.
+func (c *Cmd) Pid() int {
+	return c.pid
+}
+
+// SetShutdown sets the stop sequence used by Supervise.
+func (c *Cmd) SetShutdown(s Shutdown) *Cmd {
+	c.shutdown = s
+	return c
+}
+
+// children serialises waiting for child processes. Commands run while a
+// process is supervised, e.g. jcmd on shutdown, hold it for reading, so the
+// supervisor doesn't reap them, when it waits for any child.
+var children sync.RWMutex
+
+// outputDrainTimeout limits waiting for the output of a process, that
+// exited, but left children holding its stdout or stderr.
+const outputDrainTimeout = 2 * time.Second
+
+// output copies output of a supervised process to a writer.
+type output struct {
+	r    *os.File
+	w    io.Writer
+	done chan struct{}
+}
+
+// pipe returns the file for the child to write to. Output is copied to w,
+// or written directly to the file of java-tuner, when w is nil.
+func pipe(w io.Writer, file *os.File) (*os.File, *output, error) {
+	if w == nil {
+		return file, nil, nil
+	}
+	r, child, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	return child, &output{r: r, w: w, done: make(chan struct{})}, nil
+}
+
+func (o *output) start() {
+	if o == nil {
+		return
+	}
+	go func() {
+		defer close(o.done)
+		defer o.r.Close()
+		if _, err := io.Copy(o.w, o.r); err != nil {
+			log.Warn().Err(err).Msg("Could not copy output of supervised process")
+		}
+	}()
+}
+
+// wait waits until the output is copied.
+func (o *output) wait() {
+	if o == nil {
+		return
+	}
+	select {
+	case <-o.done:
+	case <-time.After(outputDrainTimeout):
+		log.Debug().Msg("Output of supervised process is still open, not waiting for it")
+	}
+}
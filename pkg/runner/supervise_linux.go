@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// prSetChildSubreaper makes orphaned descendants children of this process,
+// so they can be reaped when java-tuner is not PID 1.
+const prSetChildSubreaper = 36
+
+// Supervise starts the command as a child in its own process group and
+// waits for it. Meanwhile it forwards all catchable signals to the group
+// and reaps zombies, like a minimal init (tini, dumb-init). On termination
+// it follows the Shutdown sequence, if set.
+func (c *Cmd) Supervise() (ExitStatus, error) {
+	if c.cmd == "" {
+		return ExitStatus{}, errors.New("command not set")
+	}
+	if c.preText != "" {
+		log.Info().Msg(c.preText)
+	}
+
+	if os.Getpid() != 1 {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+			log.Debug().Err(errno).Msg("Could not become a child subreaper, orphans won't be reaped")
+		}
+	}
+
+	// register before start, not to miss SIGCHLD of a short-living child
+	signals := make(chan os.Signal, 64)
+	signal.Notify(signals)
+	defer signal.Stop(signals)
+
+	stdout, stdoutCopy, err := pipe(c.stdout, os.Stdout)
+	if err != nil {
+		return ExitStatus{}, err
+	}
+	stderr, stderrCopy, err := pipe(c.stderr, os.Stderr)
+	if err != nil {
+		return ExitStatus{}, err
+	}
+
+	cmd := exec.Command(c.cmd, c.args...)
+	cmd.Env = c.environ()
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, stdout, stderr
+	// the supervisor keeps the terminal, so Ctrl-C reaches it and goes through
+	// the shutdown sequence, instead of interrupting the group directly
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	log.Debug().Str("cmd", c.cmd).Interface("args", c.args).Msg("Starting supervised process")
+	err = cmd.Start()
+	// only the child writes to pipes now, so they're closed when it exits
+	for _, f := range []*os.File{stdout, stderr} {
+		if f != os.Stdout && f != os.Stderr {
+			f.Close()
+		}
+	}
+	if err == nil {
+		c.pid = cmd.Process.Pid
+	}
+	// started after the pid is set, so writers can read it
+	stdoutCopy.start()
+	stderrCopy.start()
+	if err != nil {
+		log.Error().Err(err).Str("cmd", c.cmd).Interface("args", c.args).Msg("Could not start command")
+		return ExitStatus{}, err
+	}
+	pid := c.pid
+	log.Info().Int("pid", pid).Msg("Supervising Java process")
+
+	// stages of the shutdown sequence, nil until it starts
+	var threadDump, kill <-chan time.Time
+	// orphans left while a helper was running are reaped, once it's done
+	helperDone := make(chan struct{}, 1)
+	stopped := false
+	for {
+		select {
+		case sig := <-signals:
+			switch sig {
+			case syscall.SIGCHLD:
+			case syscall.SIGURG: // used by the Go runtime for preemption
+				continue
+			default:
+				log.Debug().Str("signal", sig.String()).Int("pid", pid).Msg("Forwarding signal")
+				signalProcess(-pid, sig.(syscall.Signal))
+				stopped = stopped || sig == syscall.SIGTERM || sig == syscall.SIGINT || sig == syscall.SIGHUP
+				if (sig == syscall.SIGTERM || sig == syscall.SIGINT) && kill == nil && c.shutdown.enabled() {
+					log.Info().Str("signal", sig.String()).Stringer("threadDumpAfter", c.shutdown.ThreadDumpAfter).Stringer("killAfter", c.shutdown.KillAfter).Msg("Shutdown started")
+					threadDump, kill = time.After(c.shutdown.ThreadDumpAfter), time.After(c.shutdown.KillAfter)
+				}
+			}
+		case <-threadDump:
+			threadDump = nil
+			log.Warn().Int("pid", pid).Msg("Java is still running, requesting a thread dump")
+			signalProcess(pid, syscall.SIGQUIT)
+			if c.shutdown.OnThreadDump != nil {
+				go func() {
+					c.shutdown.OnThreadDump(pid)
+					helperDone <- struct{}{}
+				}()
+			}
+		case <-helperDone:
+		case <-kill:
+			log.Error().Int("pid", pid).Stringer("after", c.shutdown.KillAfter).Msg("Java did not stop in time, killing it")
+			signalProcess(-pid, syscall.SIGKILL)
+		}
+		// signals might be coalesced, so reap everything that exited
+		if status, exited := reap(pid); exited {
+			status.Stopped = stopped
+			stdoutCopy.wait()
+			stderrCopy.wait()
+			return status, nil
+		}
+	}
+}
+
+func signalProcess(pid int, sig syscall.Signal) {
+	if err := syscall.Kill(pid, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+		log.Warn().Err(err).Str("signal", sig.String()).Msg("Could not send signal")
+	}
+}
+
+// reap waits for all exited children without blocking. It reports the
+// status of pid, once it exited. While helper commands are running, only
+// pid is waited for, not to take their exit status.
+func reap(pid int) (ExitStatus, bool) {
+	wpid := -1
+	if children.TryLock() {
+		defer children.Unlock()
+	} else {
+		wpid = pid
+	}
+	for {
+		var ws syscall.WaitStatus
+		child, err := syscall.Wait4(wpid, &ws, syscall.WNOHANG, nil)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil || child <= 0 {
+			return ExitStatus{}, false
+		}
+		if child != pid {
+			log.Debug().Int("pid", child).Msg("Reaped orphaned process")
+			continue
+		}
+		switch {
+		case ws.Exited():
+			return ExitStatus{Code: ws.ExitStatus()}, true
+		case ws.Signaled():
+			return ExitStatus{Signal: ws.Signal()}, true
+		}
+	}
+}
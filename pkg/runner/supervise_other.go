@@ -0,0 +1,14 @@
+//go:build !linux
+
+package runner
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Supervise is supported only on Linux, where java-tuner runs in
+// containers.
+func (c *Cmd) Supervise() (ExitStatus, error) {
+	return ExitStatus{}, fmt.Errorf("supervisor mode is not supported on %s", runtime.GOOS)
+}
@@ -1,27 +1,180 @@
 package tuner
 
-import "github.com/rs/zerolog/log"
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 
-var BLACKLISTED_OPTS map[string]string = map[string]string{
-	"-XX:MaxRAMFraction=1": "This option requests whole container memory, not leaving room for system buffers, which can lead to OOM errors.",
-	// https://blog.csanchez.org/2017/05/31/running-a-jvm-in-a-container-without-getting-killed/
-	"-XX:+UseCGroupMemoryLimitForHeap": "This option will only request 25% of the container memory limit, which is often too low for production workloads.",
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// Severities of blacklist rules.
+const (
+	SeverityWarn  = "warn"  // keep the option, but warn about it
+	SeverityStrip = "strip" // drop the option, adding the replacement if set
+	SeverityFail  = "fail"  // refuse to start
+)
+
+// Placeholders in a replacement: percentagePlaceholder is filled with the
+// selected heap percentage, fractionPlaceholder with the percentage matching
+// the -XX:MaxRAMFraction=N value of the option (100/N).
+const (
+	percentagePlaceholder = "{percentage}"
+	fractionPlaceholder   = "{fraction-percentage}"
+)
+
+// BlacklistRule describes options provided by the user, that are known to
+// be harmful. Options are matched with a glob Pattern or a Regex, which
+// has to match the whole option. Replacement might refer to Regex groups
+// ($1), {percentage} and {fraction-percentage}. The rule applies only to Java versions between
+// MinVersion (included) and MaxVersion (excluded), when set.
+type BlacklistRule struct {
+	Pattern     string `mapstructure:"pattern"`
+	Regex       string `mapstructure:"regex"`
+	MinVersion  string `mapstructure:"min-version"`
+	MaxVersion  string `mapstructure:"max-version"`
+	Severity    string `mapstructure:"severity"`
+	Replacement string `mapstructure:"replacement"`
+	Reason      string `mapstructure:"reason"`
+
+	re *regexp.Regexp
+}
+
+// DefaultBlacklist is always applied, after the rules loaded from files.
+var DefaultBlacklist = []BlacklistRule{
+	{
+		Pattern:    "-XX:MaxRAMFraction=1",
+		MaxVersion: "v1.8.191",
+		Severity:   SeverityStrip,
+		Reason:     "This option requests whole container memory, not leaving room for system buffers, which can lead to OOM errors.",
+	},
+	{
+		// https://blog.csanchez.org/2017/05/31/running-a-jvm-in-a-container-without-getting-killed/
+		Pattern:    "-XX:+UseCGroupMemoryLimitForHeap",
+		MaxVersion: "v1.8.191",
+		Severity:   SeverityStrip,
+		Reason:     "This option will only request 25% of the container memory limit, which is often too low for production workloads.",
+	},
+	{
+		Pattern:     "-XX:MaxRAMFraction=*",
+		MinVersion:  "v1.8.191",
+		Severity:    SeverityStrip,
+		Replacement: "-XX:MaxRAMPercentage=" + fractionPlaceholder,
+		Reason:      "Fractions allow only 100%, 50%, 33% and so on of the memory limit, percentage is more precise.",
+	},
+	{
+		Pattern:     "-XX:+UseCGroupMemoryLimitForHeap",
+		MinVersion:  "v1.8.191",
+		Severity:    SeverityStrip,
+		Replacement: "-XX:MaxRAMPercentage=" + percentagePlaceholder,
+		Reason:      "Container memory limit is detected by default, this option will only request 25% of it.",
+	},
+}
+
+// LoadBlacklist reads blacklist rules from the `blacklist` key of a YAML,
+// JSON or TOML file.
+func LoadBlacklist(path string) ([]BlacklistRule, error) {
+	config := viper.New()
+	config.SetConfigFile(path)
+	if err := config.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("could not read blacklist %s: %w", path, err)
+	}
+	rules := []BlacklistRule{}
+	if err := config.UnmarshalKey("blacklist", &rules); err != nil {
+		return nil, fmt.Errorf("could not parse blacklist %s: %w", path, err)
+	}
+	for i, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d in blacklist %s: %w", i+1, path, err)
+		}
+	}
+	log.Debug().Str("file", path).Int("rules", len(rules)).Msg("Loaded blacklist rules")
+	return rules, nil
+}
+
+func (r BlacklistRule) validate() error {
+	switch {
+	case r.Pattern == "" && r.Regex == "":
+		return fmt.Errorf("pattern or regex is required")
+	case r.Severity != SeverityWarn && r.Severity != SeverityStrip && r.Severity != SeverityFail:
+		return fmt.Errorf("unknown severity %q, use warn, strip or fail", r.Severity)
+	}
+	if r.Regex != "" {
+		if _, err := regexp.Compile(r.Regex); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func FilterBlacklisted(opts []string) []string {
-	var filtered []string
+// ApplyBlacklist checks options provided by the user against the rules.
+// It fails on the first option matching a rule with fail severity.
+func ApplyBlacklist(opts []string, rules []BlacklistRule, javaVersion string, percentage float64) ([]string, error) {
+	filtered := []string{}
 	for _, opt := range opts {
-		blacklisted := false
-		for blacklistedOpt, reason := range BLACKLISTED_OPTS {
-			if opt == blacklistedOpt {
-				blacklisted = true
-				log.Warn().Str("option", opt).Str("reason", reason).Msg("Filtered out blacklisted JVM option")
-				break
-			}
+		rule, ok := matchBlacklist(opt, rules, javaVersion)
+		if !ok {
+			filtered = append(filtered, opt)
+			continue
 		}
-		if !blacklisted {
+		replacement := rule.replacement(opt, percentage)
+		switch rule.Severity {
+		case SeverityFail:
+			return opts, fmt.Errorf("option %s is not allowed: %s", opt, rule.Reason)
+		case SeverityWarn:
+			log.Warn().Str("option", opt).Str("suggestion", replacement).Str("reason", rule.Reason).Msg("Blacklisted JVM option")
 			filtered = append(filtered, opt)
+		default:
+			if replacement == "" {
+				log.Warn().Str("option", opt).Str("reason", rule.Reason).Msg("Filtered out blacklisted JVM option")
+				continue
+			}
+			log.Warn().Str("option", opt).Str("replacement", replacement).Str("reason", rule.Reason).Msg("Replaced blacklisted JVM option")
+			filtered = append(filtered, replacement)
+		}
+	}
+	return filtered, nil
+}
+
+// matchBlacklist returns the first rule matching the option.
+func matchBlacklist(opt string, rules []BlacklistRule, javaVersion string) (BlacklistRule, bool) {
+	for _, rule := range rules {
+		if rule.MinVersion != "" && !versionAtLeast(javaVersion, rule.MinVersion) ||
+			rule.MaxVersion != "" && versionAtLeast(javaVersion, rule.MaxVersion) {
+			continue
+		}
+		if rule.Regex != "" {
+			re, err := regexp.Compile("^(?:" + rule.Regex + ")$")
+			if err != nil {
+				log.Warn().Err(err).Str("regex", rule.Regex).Msg("Skipping blacklist rule with invalid regex")
+				continue
+			}
+			if re.MatchString(opt) {
+				rule.re = re
+				return rule, true
+			}
+		}
+		if rule.Pattern != "" && matchesAny(opt, []string{rule.Pattern}) {
+			return rule, true
+		}
+	}
+	return BlacklistRule{}, false
+}
+
+func (r BlacklistRule) replacement(opt string, percentage float64) string {
+	replacement := r.Replacement
+	if r.re != nil && replacement != "" {
+		replacement = r.re.ReplaceAllString(opt, replacement)
+	}
+	if strings.Contains(replacement, fractionPlaceholder) {
+		fraction := percentage
+		_, value, _ := strings.Cut(opt, "=")
+		if n, err := strconv.ParseFloat(value, 64); err == nil && n > 0 {
+			fraction = 100 / n
 		}
+		replacement = strings.ReplaceAll(replacement, fractionPlaceholder, fmt.Sprintf("%.1f", fraction))
 	}
-	return filtered
+	return strings.ReplaceAll(replacement, percentagePlaceholder, fmt.Sprintf("%.1f", percentage))
 }
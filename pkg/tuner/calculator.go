@@ -0,0 +1,154 @@
+package tuner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Defaults of the memory calculator, inspired by the Cloud Foundry Java
+// buildpack.
+const (
+	DefaultThreadCount  = 250
+	DefaultStackSize    = 1 * MiB
+	DefaultDirectMemory = 10 * MiB
+	DefaultCodeCache    = 240 * MiB // with tiered compilation
+	DefaultHeadroom     = 100 * MiB // left for the OS and other processes
+	// Used when the number of classes is unknown, typical for a mid-sized
+	// Spring Boot service.
+	DefaultClassCount = 20000
+
+	legacyCodeCache        = 48 * MiB // without tiered compilation
+	metaspacePerClass      = 5800
+	metaspaceBase          = 14000000
+	minCalculatedHeapBytes = 16 * MiB
+)
+
+// MemoryCalculator holds the inputs to calculate memory regions of JVM.
+// Zero values are replaced with defaults.
+type MemoryCalculator struct {
+	Enabled      bool
+	ThreadCount  int
+	ClassCount   int
+	StackSize    uint64
+	DirectMemory uint64
+	CodeCache    uint64
+	Metaspace    uint64
+	Headroom     uint64
+}
+
+// MemoryPlan describes how the memory limit is divided between JVM
+// memory regions.
+type MemoryPlan struct {
+	Total        uint64
+	Heap         uint64
+	Metaspace    uint64
+	CodeCache    uint64
+	DirectMemory uint64
+	StackSize    uint64
+	Stacks       uint64
+	Headroom     uint64
+	ThreadCount  int
+	ClassCount   int
+}
+
+// Calculate estimates non-heap memory regions and gives the rest to heap.
+// It fails when the memory limit is too small to fit all of them.
+func (c MemoryCalculator) Calculate(total uint64, javaVersion string) (MemoryPlan, error) {
+	plan := MemoryPlan{
+		Total:        total,
+		ThreadCount:  c.ThreadCount,
+		ClassCount:   c.ClassCount,
+		StackSize:    c.StackSize,
+		DirectMemory: c.DirectMemory,
+		CodeCache:    c.CodeCache,
+		Metaspace:    c.Metaspace,
+		Headroom:     c.Headroom,
+	}
+
+	if plan.ThreadCount <= 0 {
+		plan.ThreadCount = DefaultThreadCount
+	}
+	if plan.ClassCount <= 0 {
+		log.Warn().Int("classCount", DefaultClassCount).Msg("Number of loaded classes unknown, assuming default")
+		plan.ClassCount = DefaultClassCount
+	}
+	if plan.StackSize == 0 {
+		plan.StackSize = DefaultStackSize
+	}
+	if plan.DirectMemory == 0 {
+		plan.DirectMemory = DefaultDirectMemory
+	}
+	if plan.CodeCache == 0 {
+		plan.CodeCache = DefaultCodeCache
+		if !versionAtLeast(javaVersion, "v1.8") {
+			plan.CodeCache = legacyCodeCache
+		}
+	}
+	if plan.Metaspace == 0 {
+		plan.Metaspace = roundUp(uint64(plan.ClassCount)*metaspacePerClass+metaspaceBase, MiB)
+	}
+	if plan.Headroom == 0 {
+		plan.Headroom = DefaultHeadroom
+	}
+	plan.Stacks = uint64(plan.ThreadCount) * plan.StackSize
+
+	nonHeap := plan.Metaspace + plan.CodeCache + plan.Stacks + plan.DirectMemory + plan.Headroom
+	if nonHeap+minCalculatedHeapBytes > total {
+		return plan, fmt.Errorf("memory limit %s is too low, non-heap memory requires %s "+
+			"(metaspace %s, code cache %s, %d thread stacks %s, direct memory %s, headroom %s)",
+			FormatSize(total), FormatSize(nonHeap),
+			FormatSize(plan.Metaspace), FormatSize(plan.CodeCache), plan.ThreadCount,
+			FormatSize(plan.Stacks), FormatSize(plan.DirectMemory), FormatSize(plan.Headroom))
+	}
+	plan.Heap = (total - nonHeap) / MiB * MiB
+
+	return plan, nil
+}
+
+// Options returns JVM flags applying the plan.
+func (p MemoryPlan) Options() []string {
+	return []string{
+		"-Xmx" + FormatSize(p.Heap),
+		"-Xss" + FormatSize(p.StackSize),
+		"-XX:MaxMetaspaceSize=" + FormatSize(p.Metaspace),
+		"-XX:ReservedCodeCacheSize=" + FormatSize(p.CodeCache),
+		"-XX:MaxDirectMemorySize=" + FormatSize(p.DirectMemory),
+	}
+}
+
+// withUserFlags takes the memory regions set explicitly by the user into
+// account, so the calculation matches what JVM will really use.
+func (c MemoryCalculator) withUserFlags(opts []string) MemoryCalculator {
+	prefixes := map[string]*uint64{
+		"-Xss":                       &c.StackSize,
+		"-XX:ThreadStackSize=":       &c.StackSize,
+		"-XX:MaxDirectMemorySize=":   &c.DirectMemory,
+		"-XX:ReservedCodeCacheSize=": &c.CodeCache,
+		"-XX:MaxMetaspaceSize=":      &c.Metaspace,
+	}
+	for _, opt := range opts {
+		for prefix, target := range prefixes {
+			if !strings.HasPrefix(opt, prefix) {
+				continue
+			}
+			value := strings.TrimPrefix(opt, prefix)
+			if prefix == "-XX:ThreadStackSize=" {
+				value += "k" // expressed in kilobytes
+			}
+			size, err := ParseSize(value)
+			if err != nil {
+				log.Warn().Err(err).Str("option", opt).Msg("Could not parse size of user option")
+				continue
+			}
+			log.Debug().Str("option", opt).Uint64("size", size).Msg("Using user option in memory calculation")
+			*target = size
+		}
+	}
+	return c
+}
+
+func roundUp(value, unit uint64) uint64 {
+	return (value + unit - 1) / unit * unit
+}
@@ -0,0 +1,273 @@
+package tuner
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Average size of a class in the JDK lib/modules image.
+	jdkModulesBytesPerClass = 4800
+	// Only a part of the classes on the classpath is loaded at runtime,
+	// same as in Cloud Foundry Java buildpack.
+	loadedClassesFactor = 0.35
+)
+
+// Java options, that take the next argument as a value.
+var javaOptsWithValue = map[string]bool{
+	"-cp":                   true,
+	"-classpath":            true,
+	"--class-path":          true,
+	"-p":                    true,
+	"--module-path":         true,
+	"--upgrade-module-path": true,
+	"--add-modules":         true,
+	"--add-opens":           true,
+	"--add-exports":         true,
+	"--add-reads":           true,
+	"--patch-module":        true,
+	"--limit-modules":       true,
+	"-m":                    true,
+	"--module":              true,
+}
+
+// ClassScan holds the result of a classpath scan.
+type ClassScan struct {
+	Entries    []string
+	AppClasses int
+	JDKClasses int
+	Loaded     int
+}
+
+// ClasspathFromArgs extracts the classpath from the arguments passed to
+// Java. It falls back to CLASSPATH environment variable, as Java does.
+func ClasspathFromArgs(args []string) []string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-jar" && i+1 < len(args):
+			// classpath options are ignored when running a jar
+			return []string{args[i+1]}
+		case (arg == "-cp" || arg == "-classpath" || arg == "--class-path") && i+1 < len(args):
+			return filepath.SplitList(args[i+1])
+		case strings.HasPrefix(arg, "--class-path="):
+			return filepath.SplitList(strings.TrimPrefix(arg, "--class-path="))
+		case javaOptsWithValue[arg]:
+			i++
+		case !strings.HasPrefix(arg, "-"):
+			// main class, everything after belongs to the application
+			i = len(args)
+		}
+	}
+	return filepath.SplitList(os.Getenv("CLASSPATH"))
+}
+
+// ScanClasspath counts classes in the classpath entries and in the JDK
+// found in javaHome, then estimates how many of them will be loaded.
+func ScanClasspath(entries []string, javaHome string) ClassScan {
+	scan := ClassScan{}
+	for _, entry := range expandClasspath(entries) {
+		count, err := countClasses(entry)
+		if err != nil {
+			log.Warn().Err(err).Str("entry", entry).Msg("Could not scan classpath entry")
+			continue
+		}
+		log.Debug().Str("entry", entry).Int("classes", count).Msg("Scanned classpath entry")
+		scan.Entries = append(scan.Entries, entry)
+		scan.AppClasses += count
+	}
+
+	scan.JDKClasses = countJDKClasses(javaHome)
+	scan.Loaded = int(float64(scan.AppClasses+scan.JDKClasses) * loadedClassesFactor)
+	return scan
+}
+
+// expandClasspath resolves wildcards and Class-Path manifest entries.
+func expandClasspath(entries []string) []string {
+	expanded := []string{}
+	seen := map[string]bool{}
+	var add func(entry string)
+	add = func(entry string) {
+		if entry == "" || seen[entry] {
+			return
+		}
+		seen[entry] = true
+		expanded = append(expanded, entry)
+		for _, ref := range manifestClasspath(entry) {
+			add(ref)
+		}
+	}
+
+	for _, entry := range entries {
+		if filepath.Base(entry) != "*" {
+			add(entry)
+			continue
+		}
+		// same as Java, wildcard matches only jar files in the directory
+		dir := filepath.Dir(entry)
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			log.Warn().Err(err).Str("entry", entry).Msg("Could not expand classpath wildcard")
+			continue
+		}
+		for _, file := range files {
+			if !file.IsDir() && isJar(file.Name()) {
+				add(filepath.Join(dir, file.Name()))
+			}
+		}
+	}
+	return expanded
+}
+
+// manifestClasspath returns the Class-Path entries from the jar manifest,
+// resolved against the jar location.
+func manifestClasspath(path string) []string {
+	if !isJar(path) {
+		return nil
+	}
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil
+	}
+	defer archive.Close()
+
+	manifest, err := archive.Open("META-INF/MANIFEST.MF")
+	if err != nil {
+		return nil
+	}
+	defer manifest.Close()
+
+	// long manifest lines are wrapped and continued with a leading space
+	value := ""
+	inClasspath := false
+	scanner := bufio.NewScanner(manifest)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, "Class-Path:"):
+			inClasspath = true
+			value = strings.TrimPrefix(line, "Class-Path:")
+		case inClasspath && strings.HasPrefix(line, " "):
+			value += line[1:]
+		default:
+			inClasspath = false
+		}
+	}
+
+	refs := []string{}
+	for _, ref := range strings.Fields(value) {
+		refs = append(refs, filepath.Join(filepath.Dir(path), filepath.FromSlash(ref)))
+	}
+	return refs
+}
+
+// countClasses counts classes in a directory or jar file.
+func countClasses(path string) (int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if !info.IsDir() {
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return 0, err
+		}
+		defer archive.Close()
+		return countZipClasses(&archive.Reader)
+	}
+
+	count := 0
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && isClass(d.Name()) {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// countZipClasses counts classes in the archive, including jars nested
+// in Spring Boot (BOOT-INF/lib) and web application (WEB-INF/lib) archives.
+func countZipClasses(archive *zip.Reader) (int, error) {
+	count := 0
+	for _, file := range archive.File {
+		switch {
+		case isClass(file.Name):
+			count++
+		case isJar(file.Name) && (strings.HasPrefix(file.Name, "BOOT-INF/lib/") || strings.HasPrefix(file.Name, "WEB-INF/lib/")):
+			nested, err := countNestedClasses(file)
+			if err != nil {
+				log.Warn().Err(err).Str("entry", file.Name).Msg("Could not scan nested jar")
+				continue
+			}
+			count += nested
+		}
+	}
+	return count, nil
+}
+
+func countNestedClasses(file *zip.File) (int, error) {
+	r, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	nested, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	return countZipClasses(nested)
+}
+
+// countJDKClasses estimates number of classes in the JDK. Java 9+ keeps
+// them in the lib/modules image, older versions in rt.jar.
+func countJDKClasses(javaHome string) int {
+	if javaHome == "" {
+		return 0
+	}
+	if info, err := os.Stat(filepath.Join(javaHome, "lib", "modules")); err == nil {
+		return int(info.Size() / jdkModulesBytesPerClass)
+	}
+	for _, rt := range []string{filepath.Join(javaHome, "jre", "lib", "rt.jar"), filepath.Join(javaHome, "lib", "rt.jar")} {
+		if count, err := countClasses(rt); err == nil {
+			return count
+		}
+	}
+	log.Warn().Str("javaHome", javaHome).Msg("Could not find JDK classes, skipping them in class count")
+	return 0
+}
+
+// JavaHome finds Java installation directory from the path to its binary.
+func JavaHome(javaBin string) string {
+	path, err := filepath.EvalSymlinks(javaBin)
+	if err != nil {
+		return ""
+	}
+	// <java home>/bin/java
+	return filepath.Dir(filepath.Dir(path))
+}
+
+func isClass(name string) bool {
+	return strings.HasSuffix(name, ".class") && !strings.HasSuffix(name, "module-info.class")
+}
+
+func isJar(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".jar")
+}
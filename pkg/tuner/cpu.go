@@ -9,8 +9,22 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// CPULimit detects how many CPUs are assigned to the container.
+// CPULimit detects how many CPUs are assigned to the container, rounded
+// to the whole number.
 func CPULimit() int {
+	return roundCPUs(CPUQuota())
+}
+
+func roundCPUs(cpus float64) int {
+	if cpus < 1 {
+		log.Warn().Float64("cpus", cpus).Msg("Detected less than 1 CPU, rounding up to 1")
+		return 1
+	}
+	return int(cpus + 0.5) // round up
+}
+
+// CPUQuota detects the fractional number of CPUs assigned to the container.
+func CPUQuota() float64 {
 	// Try cgroup v1: /sys/fs/cgroup/cpu/cpu.cfs_quota_us and cpu.cfs_period_us
 	quotaPath := "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"
 	periodPath := "/sys/fs/cgroup/cpu/cpu.cfs_period_us"
@@ -28,7 +42,7 @@ func CPULimit() int {
 			log.Debug().Str("cpu.max", string(data)).Err(err).Msg("Read CPU max")
 			if len(parts) == 2 {
 				if parts[0] == "max" {
-					return runtime.NumCPU()
+					return float64(runtime.NumCPU())
 				}
 				quota, err1 = strconv.Atoi(parts[0])
 				period, err2 = strconv.Atoi(parts[1])
@@ -38,18 +52,14 @@ func CPULimit() int {
 
 	if err1 == nil && err2 == nil && quota > 0 && period > 0 {
 		cpus := float64(quota) / float64(period)
-		if cpus < 1 {
-			log.Warn().Float64("cpus", cpus).Msg("Detected less than 1 CPU, rounding up to 1")
-			return 1
-		}
 		log.Debug().Float64("cpus", cpus).Msg("Detected CPU limit")
-		return int(cpus + 0.5) // round up
+		return cpus
 	}
 
 	// Fallback: use system CPU count
 	cpus := runtime.NumCPU()
 	log.Warn().Int("cpus", cpus).Msg("Failed to detect CPU limit, using system CPU count")
-	return cpus
+	return float64(cpus)
 }
 
 func readIntFromFile(path string) (int, error) {
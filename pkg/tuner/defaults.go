@@ -8,34 +8,86 @@ import (
 	"golang.org/x/mod/semver"
 )
 
+// Defaults holds the settings for supported Java versions. Version ranges
+// include minVersion and exclude maxVersion. Java 8 and older updates are
+// compared as patch versions (8u191 is v1.8.191).
 var Defaults []ConfigSet = []ConfigSet{
 	{
+		// no container support, 8u131 added the experimental
+		// -XX:+UseCGroupMemoryLimitForHeap, but it's ignored with explicit
+		// -Xmx and -Xms, and the container limit is detected here anyway
 		minVersion: "v1.7",
-		maxVersion: "v9.0",
+		maxVersion: "v1.8.191",
 		// older versions of Java preferred both initial and max RAM to be the same
 		maxRamPercentage:     80.0,
 		initialRamPercentage: 80.0,
+		ramCurve:             defaultRAMCurve,
 		maxRamFlags: []string{
-			"-Xmx=%.0fm",
+			"-Xmx%.0fm",
 		},
 		initialRamFlags: []string{
-			"-Xms=%.0fm",
+			"-Xms%.0fm",
 		},
 		opts: []string{
 			"-XX:+AlwaysActAsServerClassMachine",     // Always use server JVM
 			"-Dnetworkaddress.cache.ttl=10",          // DNS cache
 			"-Dnetworkaddress.cache.negative.ttl=10", // Negative DNS cache
-			"-XX:+UseStringDeduplication",            // Enable string deduplication
 			"-Xshare:off",
 		},
 	},
 	{
-		minVersion: "v10.0",
-		maxVersion: "v25.0",
+		// container support backported from Java 10
+		minVersion:           "v1.8.191",
+		maxVersion:           "v1.9",
+		maxRamPercentage:     70.0,
+		initialRamPercentage: 25.0,
+		ramCurve:             defaultRAMCurve,
+		percentageHeap:       true,
+		activeProcessorCount: true,
+		maxRamFlags: []string{
+			"-XX:MaxRAMPercentage=%.1f",
+		},
+		initialRamFlags: []string{
+			"-XX:InitialRAMPercentage=%.1f",
+			"-XX:MinRAMPercentage=%.1f",
+		},
+		opts: []string{
+			"-XX:+AlwaysActAsServerClassMachine",     // Always use server JVM
+			"-Dnetworkaddress.cache.ttl=10",          // DNS cache
+			"-Dnetworkaddress.cache.negative.ttl=10", // Negative DNS cache
+			"-Xshare:off",
+		},
+	},
+	{
+		minVersion: "v9",
+		maxVersion: "v10",
+		// older versions of Java preferred both initial and max RAM to be the same
+		maxRamPercentage:     80.0,
+		initialRamPercentage: 80.0,
+		ramCurve:             defaultRAMCurve,
+		maxRamFlags: []string{
+			"-Xmx%.0fm",
+		},
+		initialRamFlags: []string{
+			"-Xms%.0fm",
+		},
+		opts: []string{
+			"-XX:+AlwaysActAsServerClassMachine",     // Always use server JVM
+			"-Dnetworkaddress.cache.ttl=10",          // DNS cache
+			"-Dnetworkaddress.cache.negative.ttl=10", // Negative DNS cache
+			"-Xshare:off",
+		},
+	},
+	{
+		minVersion: "v10",
+		maxVersion: "v26",
 		// Java 10+ prefers MaxRAMPercentage and InitialRAMPercentage
 		// instead of -Xmx and -Xms
 		maxRamPercentage:     70.0,
 		initialRamPercentage: 25.0,
+		ramCurve:             defaultRAMCurve,
+		percentageHeap:       true,
+		activeProcessorCount: true,
 		maxRamFlags: []string{
 			"-XX:MaxRAMPercentage=%.1f",
 		},
@@ -47,22 +99,88 @@ var Defaults []ConfigSet = []ConfigSet{
 			"-XX:+AlwaysActAsServerClassMachine",     // Always use server JVM
 			"-Dnetworkaddress.cache.ttl=10",          // DNS cache
 			"-Dnetworkaddress.cache.negative.ttl=10", // Negative DNS cache
-			"-XX:+UseStringDeduplication",            // Enable string deduplication
 			"-Xshare:off",
 		},
 	},
 }
 
+// Small containers need relatively more memory outside of the heap, big
+// ones can give most of it to the heap.
+var defaultRAMCurve = []RAMBreakpoint{
+	{UpTo: 512 * MiB, Percentage: 50.0},
+	{UpTo: 2 * GiB, Percentage: 65.0},
+	{UpTo: 8 * GiB, Percentage: 75.0},
+	{Percentage: 85.0},
+}
+
+// RAMBreakpoint sets the heap percentage for memory limits up to the given
+// size. The last breakpoint usually has no upper bound.
+type RAMBreakpoint struct {
+	UpTo       uint64 // 0 means no upper bound
+	Percentage float64
+}
+
+func (b RAMBreakpoint) String() string {
+	if b.UpTo == 0 {
+		return "any"
+	}
+	return "<=" + FormatSize(b.UpTo)
+}
+
+// Known JVM vendors.
+const (
+	VendorUnknown   = "unknown"
+	VendorOracle    = "oracle"
+	VendorCorretto  = "corretto"
+	VendorTemurin   = "temurin"
+	VendorZulu      = "zulu"
+	VendorRedHat    = "redhat"
+	VendorMicrosoft = "microsoft"
+	VendorGraalVM   = "graalvm"
+	VendorOpenJ9    = "openj9"
+)
+
+// vendorMarkers are checked in order, first match wins.
+var vendorMarkers = []struct {
+	marker string
+	name   string
+}{
+	{"OpenJ9", VendorOpenJ9},
+	{"GraalVM", VendorGraalVM},
+	{"Corretto", VendorCorretto},
+	{"Temurin", VendorTemurin},
+	{"Zulu", VendorZulu},
+	{"Red_Hat", VendorRedHat},
+	{"Red Hat", VendorRedHat},
+	{"Microsoft", VendorMicrosoft},
+	{"Java(TM)", VendorOracle},
+}
+
 type ConfigSet struct {
 	minVersion           string
 	maxVersion           string
 	maxRamPercentage     float64
 	initialRamPercentage float64
+	ramCurve             []RAMBreakpoint
+	percentageHeap       bool // heap set as percentage of MaxRAM, not in MB
+	activeProcessorCount bool // -XX:ActiveProcessorCount is supported
 	maxRamFlags          []string
 	initialRamFlags      []string
 	opts                 []string
 }
 
+// RAMPercentage evaluates the heap percentage curve for the memory limit.
+// It returns the percentage and the breakpoint that was used, falling back
+// to the flat percentage if there's no matching breakpoint.
+func (c ConfigSet) RAMPercentage(memLimit uint64) (float64, string) {
+	for _, breakpoint := range c.ramCurve {
+		if breakpoint.UpTo == 0 || memLimit <= breakpoint.UpTo {
+			return breakpoint.Percentage, breakpoint.String()
+		}
+	}
+	return c.maxRamPercentage, "default"
+}
+
 // JavaVersion parses the Java version from the output string.
 // It would detect the version and return it in the SemVer format
 // vMAJOR[.MINOR[.PATCH[-PRERELEASE][+BUILD]]]
@@ -99,12 +217,105 @@ func JavaVersion(versionOutput string) (string, error) {
 	return semver, nil
 }
 
+// JavaVendor guesses the JVM vendor from the `java -version` output.
+func JavaVendor(versionOutput string) string {
+	for _, vendor := range vendorMarkers {
+		if strings.Contains(versionOutput, vendor.marker) {
+			return vendor.name
+		}
+	}
+	return VendorUnknown
+}
+
+// leadingVersion matches up to three numeric components at the start of a
+// version, e.g. v11.0.22 of vendor versions like 11.0.22.1.
+var leadingVersion = regexp.MustCompile(`^v\d+(\.\d+){0,2}`)
+
+// canonicalVersion converts version to the form accepted by semver package.
+// Java 8 and older report updates as build metadata (1.8.0+462), which
+// semver ignores, so they are moved to the patch version (v1.8.462).
+// Versions with more than three components are cut to the first three.
+func canonicalVersion(javaVersion string) string {
+	if !strings.HasPrefix(javaVersion, "v") {
+		javaVersion = "v" + javaVersion
+	}
+	if !semver.IsValid(javaVersion) {
+		base, build, found := strings.Cut(javaVersion, "+")
+		if leading := leadingVersion.FindString(base); leading != "" {
+			javaVersion = leading
+			if found {
+				javaVersion += "+" + build
+			}
+		}
+	}
+	if !strings.HasPrefix(javaVersion, "v1.") {
+		return javaVersion
+	}
+	base, build, found := strings.Cut(javaVersion, "+")
+	if !found {
+		return javaVersion
+	}
+	update := build
+	if i := strings.IndexFunc(build, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		update = build[:i] // e.g. 462-internal
+	}
+	if update == "" || semver.MajorMinor(base) == "" {
+		return javaVersion
+	}
+	return semver.MajorMinor(base) + "." + update
+}
+
+// versionAtLeast checks if javaVersion is equal or newer than minVersion.
+func versionAtLeast(javaVersion, minVersion string) bool {
+	return semver.Compare(canonicalVersion(javaVersion), minVersion) >= 0
+}
+
+// GetDefaults returns the settings for the Java version. Versions outside
+// of all known ranges fall back to the nearest profile, see MatchDefaults.
 func GetDefaults(javaVersion string) ConfigSet {
-	for _, set := range Defaults {
-		if (set.minVersion == "" || semver.Compare(javaVersion, set.minVersion) >= 0) &&
-			(set.maxVersion == "" || semver.Compare(javaVersion, set.maxVersion) <= 0) {
-			return set
+	set, _ := MatchDefaults(javaVersion)
+	return set
+}
+
+// MatchDefaults returns the settings for the Java version. When no profile
+// covers the version, it returns the nearest lower one (or the oldest one
+// for versions older than all of them) together with an error. Unparsable
+// versions get the newest profile, as it's most likely a new release.
+func MatchDefaults(javaVersion string) (ConfigSet, error) {
+	version := canonicalVersion(javaVersion)
+	if !semver.IsValid(version) {
+		return Defaults[len(Defaults)-1], fmt.Errorf("unknown Java version %q", javaVersion)
+	}
+
+	var nearest *ConfigSet
+	for i, set := range Defaults {
+		if set.Contains(version) {
+			return set, nil
+		}
+		if semver.Compare(version, set.minVersion) >= 0 &&
+			(nearest == nil || semver.Compare(set.minVersion, nearest.minVersion) > 0) {
+			nearest = &Defaults[i]
 		}
 	}
-	return ConfigSet{} // Return empty if no match found
+	if nearest == nil {
+		return Defaults[0], fmt.Errorf("unsupported Java version %s, older than all known profiles", javaVersion)
+	}
+	return *nearest, fmt.Errorf("unsupported Java version %s, newer than all known profiles", javaVersion)
+}
+
+// Contains checks if the Java version is in the range of the profile.
+func (c ConfigSet) Contains(javaVersion string) bool {
+	javaVersion = canonicalVersion(javaVersion)
+	return (c.minVersion == "" || semver.Compare(javaVersion, c.minVersion) >= 0) &&
+		(c.maxVersion == "" || semver.Compare(javaVersion, c.maxVersion) < 0)
+}
+
+// MinVersion returns the first Java version covered by the profile.
+func (c ConfigSet) MinVersion() string {
+	return c.minVersion
+}
+
+// Range returns the Java versions covered by the profile, e.g. [v10, v26).
+func (c ConfigSet) Range() string {
+	return "[" + c.minVersion + ", " + c.maxVersion + ")"
 }
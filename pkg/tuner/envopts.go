@@ -0,0 +1,186 @@
+package tuner
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Policies for JVM options set in environment variables.
+const (
+	// EnvOptsHonour lets options from the environment win, conflicting
+	// command line options are dropped.
+	EnvOptsHonour = "honour"
+	// EnvOptsOverride removes conflicting options from the environment
+	// of Java process, so command line options win.
+	EnvOptsOverride = "override"
+	// EnvOptsFail stops on any conflict.
+	EnvOptsFail = "fail"
+)
+
+// OriginEnv marks options read from environment variables.
+const OriginEnv = "env"
+
+// JVMEnvVars are read by the JVM or the java launcher itself.
+var JVMEnvVars = []string{"JAVA_TOOL_OPTIONS", "JDK_JAVA_OPTIONS", "_JAVA_OPTIONS"}
+
+// EnvOptions holds JVM options read from an environment variable.
+type EnvOptions struct {
+	Name    string
+	Options []Option
+	// ReadByJVM is false for variables like JAVA_OPTS, that are used by
+	// start scripts. Their options are passed on the command line.
+	ReadByJVM bool
+}
+
+// EnvResolution is the result of resolving conflicts with environment.
+type EnvResolution struct {
+	Args []string
+	// Env holds new values of environment variables for the Java process,
+	// empty ones should be unset.
+	Env map[string]string
+}
+
+// ReadEnvOptions reads JVM options from JVMEnvVars and the optional
+// javaOptsVar (e.g. JAVA_OPTS), skipping empty ones.
+func ReadEnvOptions(getenv func(string) string, javaOptsVar string) []EnvOptions {
+	env := []EnvOptions{}
+	read := func(name string, readByJVM bool) {
+		value := strings.TrimSpace(getenv(name))
+		if value == "" {
+			return
+		}
+		log.Debug().Str("name", name).Str("value", value).Msg("Found JVM options in environment")
+		words, err := SplitOpts(value)
+		if err != nil {
+			log.Warn().Err(err).Str("name", name).Msg("Could not parse JVM options in environment, splitting them on spaces")
+			words = strings.Fields(value)
+		}
+		env = append(env, EnvOptions{
+			Name:      name,
+			Options:   ParseOptions(words, OriginEnv),
+			ReadByJVM: readByJVM,
+		})
+	}
+	for _, name := range JVMEnvVars {
+		read(name, true)
+	}
+	if javaOptsVar != "" && !slices.Contains(JVMEnvVars, javaOptsVar) {
+		read(javaOptsVar, false)
+	}
+	return env
+}
+
+// ResolveEnvOptions finds options in the environment, that conflict with
+// the command line ones, and resolves them according to the policy.
+func ResolveEnvOptions(args []string, env []EnvOptions, policy string) (EnvResolution, error) {
+	res := EnvResolution{Env: map[string]string{}}
+	cmdline := ParseOptions(args, OriginDefault)
+	dropped := map[int]bool{}
+	extra := []string{}
+
+	for _, vars := range env {
+		kept := []string{}
+		changed := false
+		for _, envOpt := range vars.Options {
+			i := slices.IndexFunc(cmdline, func(o Option) bool { return conflicts(o, envOpt) })
+			if i < 0 {
+				if vars.ReadByJVM || !slices.ContainsFunc(cmdline, func(o Option) bool { return o.Raw == envOpt.Raw }) {
+					kept = append(kept, envOpt.Raw)
+				}
+				continue
+			}
+			conflict := cmdline[i].Raw
+			switch policy {
+			case EnvOptsFail:
+				return res, fmt.Errorf("option %s from %s conflicts with %s", envOpt.Raw, vars.Name, conflict)
+			case EnvOptsOverride:
+				log.Warn().Str("env", vars.Name).Str("option", envOpt.Raw).Str("winner", conflict).Msg("Removed conflicting option from environment")
+				changed = true
+			default:
+				log.Warn().Str("env", vars.Name).Str("option", conflict).Str("winner", envOpt.Raw).Msg("Dropped option conflicting with environment")
+				for j, o := range cmdline {
+					if conflicts(o, envOpt) {
+						dropped[j] = true
+					}
+				}
+				kept = append(kept, envOpt.Raw)
+			}
+		}
+		if !vars.ReadByJVM {
+			extra = append(extra, kept...)
+		} else if changed {
+			res.Env[vars.Name] = JoinOpts(kept)
+		}
+	}
+
+	for i, opt := range cmdline {
+		if !dropped[i] {
+			res.Args = append(res.Args, opt.Raw)
+		}
+	}
+	res.Args = append(res.Args, extra...)
+	return res, nil
+}
+
+// EffectiveOptions returns options the JVM starts with, in the order it
+// applies them: JAVA_TOOL_OPTIONS, JDK_JAVA_OPTIONS, args and _JAVA_OPTIONS
+// from environ, so the last one of a setting wins.
+func EffectiveOptions(args []string, environ []string) []string {
+	vars := map[string]string{}
+	for _, entry := range environ {
+		name, value, _ := strings.Cut(entry, "=")
+		vars[name] = value
+	}
+	opts := []string{}
+	for _, env := range ReadEnvOptions(func(name string) string { return vars[name] }, "") {
+		if env.Name == "_JAVA_OPTIONS" {
+			opts = append(opts, args...)
+			args = nil
+		}
+		for _, opt := range env.Options {
+			opts = append(opts, opt.Raw)
+		}
+	}
+	return append(opts, args...)
+}
+
+// ApplyEnv returns environ with the variables changed as requested.
+func (r EnvResolution) ApplyEnv(environ []string) []string {
+	result := []string{}
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		if _, ok := r.Env[name]; !ok {
+			result = append(result, entry)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Env)) {
+		if r.Env[name] != "" {
+			result = append(result, name+"="+r.Env[name])
+		}
+	}
+	return result
+}
+
+// conflicts checks if both options change the same JVM setting to
+// different values.
+func conflicts(a, b Option) bool {
+	return a.Raw != b.Raw && settingOf(a) == settingOf(b)
+}
+
+// settingOf groups options, that change the same JVM setting in different
+// ways, e.g. -Xmx and -XX:MaxRAMPercentage.
+func settingOf(o Option) string {
+	switch {
+	case o.Kind == KindXXSwitch && o.Value == "+" && slices.Contains(collectorFlags, o.Raw):
+		return "garbage collector"
+	case o.Key() == "-Xmx" || matchesAny(o.Raw, []string{"-XX:MaxHeapSize=*", "-XX:MaxRAMPercentage=*", "-XX:MaxRAMFraction=*"}):
+		return "max heap"
+	case o.Key() == "-Xms" || matchesAny(o.Raw, []string{"-XX:InitialHeapSize=*", "-XX:InitialRAMPercentage=*", "-XX:InitialRAMFraction=*"}):
+		return "initial heap"
+	}
+	return o.Key()
+}
@@ -0,0 +1,172 @@
+package tuner
+
+import (
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Supported garbage collectors.
+const (
+	GCAuto       = "auto"
+	GCSerial     = "serial"
+	GCParallel   = "parallel"
+	GCG1         = "g1"
+	GCZ          = "zgc"
+	GCShenandoah = "shenandoah"
+	GCCMS        = "cms" // only recognised when set by the user in --opts
+)
+
+const (
+	// Below those limits of the machine (the container), JVM ergonomics
+	// would pick SerialGC anyway, we just make it explicit.
+	serialMaxCPUs   = 2
+	serialMaxMemory = 1792 * 1024 * 1024
+	// Big heaps benefit the most from concurrent, low-pause collectors.
+	lowPauseMinHeap = 16 * 1024 * 1024 * 1024
+)
+
+// GC selection flags recognised in user provided options.
+var gcFlags map[string]string = map[string]string{
+	"-XX:+UseSerialGC":        GCSerial,
+	"-XX:+UseParallelGC":      GCParallel,
+	"-XX:+UseParallelOldGC":   GCParallel,
+	"-XX:+UseG1GC":            GCG1,
+	"-XX:+UseZGC":             GCZ,
+	"-XX:+UseShenandoahGC":    GCShenandoah,
+	"-XX:+UseConcMarkSweepGC": GCCMS,
+	"-XX:+UseParNewGC":        GCCMS,
+}
+
+// UserGC returns the garbage collector selected explicitly in the given
+// options or an empty string if there is none.
+func UserGC(opts []string) string {
+	gc := ""
+	for _, opt := range opts {
+		if name, ok := gcFlags[opt]; ok {
+			gc = name // last one wins, as in JVM
+		}
+	}
+	return gc
+}
+
+// SelectGC picks a garbage collector based on available resources,
+// Java version and the vendor capabilities. The memory limit decides, if
+// the JVM treats the machine as a server one, the heap size picks between
+// the low-pause collectors. Parallel, tuned for throughput, is only picked
+// on Java 7, otherwise it has to be requested. Zero memory limit means it's
+// unknown.
+func SelectGC(javaVersion, vendor string, cpuCount int, memLimit, heapBytes uint64) string {
+	switch {
+	case cpuCount < serialMaxCPUs || memLimit > 0 && memLimit < serialMaxMemory:
+		return GCSerial
+	case !versionAtLeast(javaVersion, "v1.8"):
+		// G1 on Java 7 was not mature enough
+		return GCParallel
+	case heapBytes >= lowPauseMinHeap && versionAtLeast(javaVersion, "v21"):
+		// generational ZGC
+		return GCZ
+	case heapBytes >= lowPauseMinHeap && versionAtLeast(javaVersion, "v17") && SupportsGC(GCShenandoah, javaVersion, vendor):
+		return GCShenandoah
+	default:
+		return GCG1
+	}
+}
+
+// SupportsGC checks if given garbage collector is available in the JVM.
+func SupportsGC(gc, javaVersion, vendor string) bool {
+	if vendor == VendorOpenJ9 {
+		// OpenJ9 uses -Xgcpolicy instead of HotSpot collectors
+		return false
+	}
+
+	switch gc {
+	case GCSerial, GCParallel:
+		return true
+	case GCG1:
+		return versionAtLeast(javaVersion, "v1.7")
+	case GCZ:
+		return versionAtLeast(javaVersion, "v11")
+	case GCShenandoah:
+		if vendor == VendorOracle {
+			// Oracle builds are shipped without Shenandoah
+			return false
+		}
+		if vendor == VendorRedHat {
+			// backported by Red Hat to their Java 8 builds
+			return versionAtLeast(javaVersion, "v1.8")
+		}
+		// upstream since 12, backported to 11.0.9
+		return versionAtLeast(javaVersion, "v11.0.9")
+	}
+	return false
+}
+
+// GCOptions returns JVM flags enabling given garbage collector.
+func GCOptions(gc, javaVersion, vendor string) []string {
+	switch gc {
+	case GCSerial:
+		return []string{"-XX:+UseSerialGC"}
+	case GCParallel:
+		return []string{"-XX:+UseParallelGC"}
+	case GCG1:
+		return []string{"-XX:+UseG1GC"}
+	case GCZ:
+		switch {
+		case !versionAtLeast(javaVersion, "v15"):
+			// experimental before Java 15
+			return []string{"-XX:+UnlockExperimentalVMOptions", "-XX:+UseZGC"}
+		case versionAtLeast(javaVersion, "v21") && !versionAtLeast(javaVersion, "v23"):
+			// generational mode is available since 21 and the default since 23
+			return []string{"-XX:+UseZGC", "-XX:+ZGenerational"}
+		}
+		return []string{"-XX:+UseZGC"}
+	case GCShenandoah:
+		// experimental upstream in Java 12-14, backports to 8 and 11 are not
+		if vendor != VendorRedHat && versionAtLeast(javaVersion, "v12") && !versionAtLeast(javaVersion, "v15") {
+			return []string{"-XX:+UnlockExperimentalVMOptions", "-XX:+UseShenandoahGC"}
+		}
+		return []string{"-XX:+UseShenandoahGC"}
+	}
+	return []string{}
+}
+
+// SupportsStringDeduplication checks if the garbage collector can
+// deduplicate strings. Before Java 18 only G1 and Shenandoah did it.
+func SupportsStringDeduplication(gc, javaVersion string) bool {
+	switch gc {
+	case GCG1:
+		return versionAtLeast(javaVersion, "v1.8")
+	case GCShenandoah:
+		return true
+	case GCSerial, GCParallel, GCZ:
+		return versionAtLeast(javaVersion, "v18")
+	}
+	return false
+}
+
+// tuneGC decides on the garbage collector and returns flags for it.
+func tuneGC(p Params, heapBytes uint64) (gc string, opts []string) {
+	if userGC := UserGC(p.OtherFlags); userGC != "" {
+		log.Debug().Str("gc", userGC).Msg("Garbage collector selected in user options")
+		return userGC, []string{}
+	}
+
+	gc = strings.ToLower(p.GC)
+	if gc != "" && gc != GCAuto {
+		if SupportsGC(gc, p.JavaVersion, p.Vendor) {
+			log.Info().Str("gc", gc).Msg("Using requested garbage collector")
+			return gc, GCOptions(gc, p.JavaVersion, p.Vendor)
+		}
+		log.Warn().Str("gc", gc).Str("version", p.JavaVersion).Str("vendor", p.Vendor).Msg("Requested garbage collector is not supported, selecting automatically")
+	}
+
+	if p.Vendor == VendorOpenJ9 {
+		log.Warn().Str("vendor", p.Vendor).Msg("Garbage collector selection is not supported on OpenJ9, leaving it to the JVM")
+		return "", []string{}
+	}
+
+	gc = SelectGC(p.JavaVersion, p.Vendor, p.CPUCount, p.MemLimit, heapBytes)
+	log.Info().Str("gc", gc).Int("cpuCount", p.CPUCount).Uint64("heap", heapBytes).Msg("Selected garbage collector")
+	return gc, GCOptions(gc, p.JavaVersion, p.Vendor)
+}
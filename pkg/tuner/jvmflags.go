@@ -0,0 +1,252 @@
+package tuner
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tgagor/java-tuner/pkg/runner"
+)
+
+// What to do with options, that the JVM doesn't accept.
+const (
+	OnInvalidDrop = "drop"
+	OnInvalidWarn = "warn"
+	OnInvalidFail = "fail"
+)
+
+// Kinds of JVM flags, experimental and diagnostic ones have to be unlocked.
+const (
+	FlagProduct      = "product"
+	FlagExperimental = "experimental"
+	FlagDiagnostic   = "diagnostic"
+)
+
+var unlockFlags = map[string]string{
+	FlagExperimental: "-XX:+UnlockExperimentalVMOptions",
+	FlagDiagnostic:   "-XX:+UnlockDiagnosticVMOptions",
+}
+
+// Java 8:  uintx MaxRAM  = 137438953472  {pd product}
+// Java 9+: size_t MaxRAM = 137438953472  {pd product} {default}
+var printFlagsLine = regexp.MustCompile(`^\s*(\S+)\s+([A-Za-z][A-Za-z0-9_]*)\s+(:?=)\s*(.*?)\s*\{([^}]*)\}(?:\s*\{([^}]*)\})?\s*$`)
+
+// JVMFlag describes a flag listed by -XX:+PrintFlagsFinal.
+type JVMFlag struct {
+	Name   string
+	Type   string // bool, intx, uintx, size_t, double, ccstr...
+	Value  string
+	Kind   string // product, experimental or diagnostic
+	Origin string // default, command line, ergonomic...
+}
+
+// JVMFlags maps flag names to their descriptions.
+type JVMFlags map[string]JVMFlag
+
+// ParsePrintFlagsFinal parses the flag table printed by
+// `java -XX:+PrintFlagsFinal -version`. Lines that aren't flags are skipped.
+func ParsePrintFlagsFinal(output string) JVMFlags {
+	flags := JVMFlags{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		m := printFlagsLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		flag := JVMFlag{
+			Type:   m[1],
+			Name:   m[2],
+			Value:  m[4],
+			Kind:   FlagProduct,
+			Origin: m[6],
+		}
+		switch {
+		case strings.Contains(m[5], FlagExperimental):
+			flag.Kind = FlagExperimental
+		case strings.Contains(m[5], FlagDiagnostic):
+			flag.Kind = FlagDiagnostic
+		}
+		if flag.Origin == "" {
+			// Java 8 marks changed flags with := instead of the origin
+			flag.Origin = "default"
+			if m[3] == ":=" {
+				flag.Origin = "command line"
+			}
+		}
+		flags[flag.Name] = flag
+	}
+	return flags
+}
+
+// LoadJVMFlags lists flags supported by the Java binary. When cacheDir is
+// set, the output is cached there for the binary, as running Java takes
+// a while.
+func LoadJVMFlags(javaBin, cacheDir string) (JVMFlags, error) {
+	cacheFile := ""
+	if cacheDir != "" {
+		cacheFile = jvmFlagsCacheFile(javaBin, cacheDir)
+		if data, err := os.ReadFile(cacheFile); err == nil {
+			log.Debug().Str("file", cacheFile).Msg("Using cached JVM flags")
+			return ParsePrintFlagsFinal(string(data)), nil
+		}
+	}
+
+	// locked flags are not listed
+	output, err := runner.New(javaBin).Arg(
+		unlockFlags[FlagExperimental],
+		unlockFlags[FlagDiagnostic],
+		"-XX:+PrintFlagsFinal",
+		"-version",
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list JVM flags: %w", err)
+	}
+	flags := ParsePrintFlagsFinal(output)
+	if len(flags) == 0 {
+		return nil, fmt.Errorf("no JVM flags found in -XX:+PrintFlagsFinal output")
+	}
+
+	if cacheFile != "" {
+		if err := os.MkdirAll(cacheDir, 0o755); err == nil {
+			err = os.WriteFile(cacheFile, []byte(output), 0o644)
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("file", cacheFile).Msg("Could not cache JVM flags")
+		}
+	}
+	return flags, nil
+}
+
+// jvmFlagsCacheFile names the cache after the binary, its size and
+// modification time, so upgraded JVMs are listed again.
+func jvmFlagsCacheFile(javaBin, cacheDir string) string {
+	key := javaBin
+	if path, err := filepath.EvalSymlinks(javaBin); err == nil {
+		key = path
+	}
+	if info, err := os.Stat(key); err == nil {
+		key = fmt.Sprintf("%s:%d:%d", key, info.Size(), info.ModTime().UnixNano())
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(cacheDir, "flags-"+hex.EncodeToString(sum[:8])+".txt")
+}
+
+// Check verifies that the JVM knows the -XX option and that it's used
+// according to its type. It returns the kind of the flag, other options
+// are not checked.
+func (f JVMFlags) Check(opt string) (string, error) {
+	if !strings.HasPrefix(opt, "-XX:") {
+		return FlagProduct, nil
+	}
+	name, _, hasValue := strings.Cut(strings.TrimPrefix(opt, "-XX:"), "=")
+	isSwitch := strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-")
+	name = strings.TrimLeft(name, "+-")
+
+	flag, ok := f[name]
+	switch {
+	case !ok:
+		return "", fmt.Errorf("unrecognized VM option %q", opt)
+	case flag.Type == "bool" && (hasValue || !isSwitch):
+		return flag.Kind, fmt.Errorf("boolean VM option %q should be set with -XX:+%s or -XX:-%s", opt, name, name)
+	case flag.Type != "bool" && isSwitch:
+		return flag.Kind, fmt.Errorf("VM option %q takes a value, e.g. -XX:%s=%s", opt, name, flag.Value)
+	}
+	return flag.Kind, nil
+}
+
+// ValidateOptions checks options against the flags supported by the JVM.
+// Invalid -XX options passed by the user (userOpts) are dropped, kept with
+// a warning or fail, depending on onInvalid, invalid generated ones are
+// always dropped. Other options are not listed by the JVM, so they are only
+// warned about. Experimental and diagnostic flags are preceded by the
+// matching unlock option, unless it's already there, an unlock option set
+// later is moved before them.
+func ValidateOptions(opts, userOpts []string, flags JVMFlags, onInvalid string) ([]string, error) {
+	valid := []string{}
+	for _, opt := range opts {
+		if isUnlockFlag(opt) && slices.Contains(valid, opt) {
+			continue
+		}
+
+		err := ValidateSyntax(opt)
+		kind := FlagProduct
+		if err == nil {
+			kind, err = flags.Check(opt)
+		}
+
+		if err != nil {
+			onInvalid := onInvalid
+			if !slices.Contains(userOpts, opt) {
+				onInvalid = OnInvalidDrop
+			}
+			switch {
+			case !strings.HasPrefix(opt, "-XX:") || onInvalid == OnInvalidWarn:
+				log.Warn().Err(err).Str("option", opt).Msg("JVM might not accept option")
+			case onInvalid == OnInvalidFail:
+				return opts, err
+			default:
+				log.Warn().Err(err).Str("option", opt).Msg("Dropped option not accepted by JVM")
+				continue
+			}
+		}
+
+		if unlock, ok := unlockFlags[kind]; ok && opt != unlock && !slices.Contains(valid, unlock) {
+			log.Debug().Str("option", opt).Str("unlock", unlock).Msg("Unlocking JVM option")
+			valid = append(valid, unlock)
+		}
+		valid = append(valid, opt)
+	}
+	return valid, nil
+}
+
+func isUnlockFlag(opt string) bool {
+	for _, unlock := range unlockFlags {
+		if opt == unlock {
+			return true
+		}
+	}
+	return false
+}
+
+// JVMStartupFailure is printed by the JVM, when it refuses to start,
+// e.g. because of invalid options.
+const JVMStartupFailure = "Could not create the Java Virtual Machine"
+
+// Errors of the JVM naming the option it refused. -XX options are named
+// without the -XX: prefix and the +/- sign.
+var invalidOptionErrors = []*regexp.Regexp{
+	regexp.MustCompile(`Unrecognized VM option '([^']+)'`),
+	regexp.MustCompile(`Improperly specified VM option '([^']+)'`),
+	regexp.MustCompile(`Missing \+/- setting for VM option '([^']+)'`),
+	regexp.MustCompile(`Unexpected \+/- setting in VM option '([^']+)'`),
+	regexp.MustCompile(`Unrecognized option: (\S+)`),
+}
+
+// InvalidOptions finds options, that the JVM refused to start with, in its
+// error output. It returns nil, when the JVM didn't fail to start or
+// failed for other reasons.
+func InvalidOptions(output string, opts []string) []string {
+	if !strings.Contains(output, JVMStartupFailure) {
+		return nil
+	}
+	var invalid []string
+	for _, re := range invalidOptionErrors {
+		for _, match := range re.FindAllStringSubmatch(output, -1) {
+			name, _, _ := strings.Cut(match[1], "=")
+			for _, opt := range ParseOptions(opts, OriginDefault) {
+				xx := opt.Kind == KindXXSwitch || opt.Kind == KindXXValue
+				if (opt.Raw == match[1] || xx && opt.Name == name) && !slices.Contains(invalid, opt.Raw) {
+					invalid = append(invalid, opt.Raw)
+				}
+			}
+		}
+	}
+	return invalid
+}
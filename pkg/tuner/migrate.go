@@ -0,0 +1,117 @@
+package tuner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Migration actions for obsolete options.
+const (
+	MigrateTranslate = "translate" // replace with the modern equivalent
+	MigrateDrop      = "drop"      // no-op in newer versions
+	MigrateFail      = "fail"      // no equivalent, JVM would not start
+)
+
+// Migration describes an option, that stopped working in Since version of
+// Java. Regex has to match the whole option, Replacement might refer to its
+// groups ($1).
+type Migration struct {
+	Regex       string
+	Since       string
+	Action      string
+	Replacement string
+	Reason      string
+}
+
+// MigrationChange is a change made to an obsolete option.
+type MigrationChange struct {
+	Option      string
+	Replacement string
+	Action      string
+	Reason      string
+}
+
+// Migrations is the knowledge base of obsolete options.
+var Migrations = []Migration{
+	// Java 8: PermGen replaced with Metaspace
+	{Regex: `-XX:PermSize=(.+)`, Since: "v1.8", Action: MigrateTranslate, Replacement: "-XX:MetaspaceSize=$1", Reason: "PermGen was replaced with Metaspace in Java 8"},
+	{Regex: `-XX:MaxPermSize=(.+)`, Since: "v1.8", Action: MigrateTranslate, Replacement: "-XX:MaxMetaspaceSize=$1", Reason: "PermGen was replaced with Metaspace in Java 8"},
+	// Java 9: unified logging
+	{Regex: `-XX:\+PrintGCDetails`, Since: "v9", Action: MigrateTranslate, Replacement: "-Xlog:gc*", Reason: "GC logging moved to unified logging in Java 9"},
+	{Regex: `-XX:\+PrintGC`, Since: "v9", Action: MigrateTranslate, Replacement: "-Xlog:gc", Reason: "GC logging moved to unified logging in Java 9"},
+	{Regex: `-Xloggc:(.+)`, Since: "v9", Action: MigrateTranslate, Replacement: "-Xlog:gc*:file=$1", Reason: "GC logging moved to unified logging in Java 9"},
+	{Regex: `-XX:\+PrintTenuringDistribution`, Since: "v9", Action: MigrateTranslate, Replacement: "-Xlog:gc+age=trace", Reason: "GC logging moved to unified logging in Java 9"},
+	{Regex: `-XX:\+PrintGCApplicationStoppedTime`, Since: "v9", Action: MigrateTranslate, Replacement: "-Xlog:safepoint", Reason: "GC logging moved to unified logging in Java 9"},
+	{Regex: `-XX:[+-]Print(GCDateStamps|GCTimeStamps)`, Since: "v9", Action: MigrateDrop, Reason: "unified logging adds timestamps with -Xlog decorators"},
+	{Regex: `-XX:([+-]UseGCLogFileRotation|NumberOfGCLogFiles=.*|GCLogFileSize=.*)`, Since: "v9", Action: MigrateDrop, Reason: "use filecount and filesize options of -Xlog to rotate logs"},
+	{Regex: `-Xincgc|-XX:[+-]CMSIncrementalMode`, Since: "v9", Action: MigrateFail, Reason: "incremental CMS was removed in Java 9 without a replacement"},
+	// Java 10-11
+	{Regex: `-XX:[+-]UseParNewGC`, Since: "v10", Action: MigrateDrop, Reason: "ParNew was removed in Java 10"},
+	{Regex: `-XX:[+-]UseCGroupMemoryLimitForHeap`, Since: "v11", Action: MigrateDrop, Reason: "container memory limit is detected by default since Java 10"},
+	{Regex: `-XX:[+-]AggressiveOpts`, Since: "v11", Action: MigrateDrop, Reason: "AggressiveOpts was removed in Java 11"},
+	// Java 14-15: CMS and ParallelOld removed
+	{Regex: `-XX:\+UseConcMarkSweepGC`, Since: "v14", Action: MigrateTranslate, Replacement: "-XX:+UseG1GC", Reason: "CMS was removed in Java 14, G1 is the closest low-pause collector"},
+	{Regex: `-XX:([+-]CMS\w+|CMS\w+=.*|[+-]UseCMS\w+|-UseConcMarkSweepGC)`, Since: "v14", Action: MigrateDrop, Reason: "CMS was removed in Java 14"},
+	{Regex: `-XX:\+UseParallelOldGC`, Since: "v15", Action: MigrateTranslate, Replacement: "-XX:+UseParallelGC", Reason: "ParallelOld is always used with Parallel GC since Java 15"},
+	// Java 18
+	{Regex: `-XX:[+-]UseBiasedLocking`, Since: "v18", Action: MigrateDrop, Reason: "biased locking was removed in Java 18"},
+}
+
+// MigrateOptions translates options, that don't work in the Java version,
+// into their modern equivalents and drops no-ops. It fails if any option
+// can't be migrated.
+func MigrateOptions(opts []string, javaVersion string) ([]string, []MigrationChange, error) {
+	migrated := []string{}
+	changes := []MigrationChange{}
+	failed := []string{}
+	for _, opt := range opts {
+		migration, re, ok := findMigration(opt, javaVersion)
+		if !ok {
+			migrated = append(migrated, opt)
+			continue
+		}
+		change := MigrationChange{Option: opt, Action: migration.Action, Reason: migration.Reason}
+		switch migration.Action {
+		case MigrateTranslate:
+			change.Replacement = re.ReplaceAllString(opt, migration.Replacement)
+			log.Warn().Str("option", opt).Str("replacement", change.Replacement).Str("reason", change.Reason).Msg("Migrated obsolete JVM option")
+			migrated = append(migrated, change.Replacement)
+		case MigrateDrop:
+			log.Warn().Str("option", opt).Str("reason", change.Reason).Msg("Dropped obsolete JVM option")
+		default:
+			failed = append(failed, fmt.Sprintf("%s (%s)", opt, change.Reason))
+		}
+		changes = append(changes, change)
+	}
+	if len(failed) > 0 {
+		return opts, changes, fmt.Errorf("options can't be migrated to Java %s: %s", javaVersion, strings.Join(failed, ", "))
+	}
+	return migrated, changes, nil
+}
+
+func findMigration(opt, javaVersion string) (Migration, *regexp.Regexp, bool) {
+	for _, migration := range Migrations {
+		if !versionAtLeast(javaVersion, migration.Since) {
+			continue
+		}
+		re := regexp.MustCompile("^(?:" + migration.Regex + ")$")
+		if re.MatchString(opt) {
+			return migration, re, true
+		}
+	}
+	return Migration{}, nil, false
+}
+
+// MajorVersion converts a major Java version like 8 or 21 to the form
+// used in profiles (v1.8 or v21).
+func MajorVersion(major string) string {
+	major = strings.TrimPrefix(major, "v")
+	switch major {
+	case "5", "6", "7", "8":
+		return "v1." + major
+	}
+	return canonicalVersion(major)
+}
@@ -0,0 +1,92 @@
+package tuner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultObjectAlignment = 8
+	// JVM needs some space below the compressed oops limit for the null
+	// page and heap base alignment, so we stay clearly below it.
+	compressedOopsMargin = 1 * GiB
+	// Without compressed oops references take twice the space, a heap needs
+	// to be about 1.5x bigger to hold the same data.
+	uncompressedOopsFactor = 1.5
+)
+
+// ObjectAlignment returns -XX:ObjectAlignmentInBytes set in the options,
+// or the JVM default.
+func ObjectAlignment(opts []string) uint64 {
+	alignment := uint64(defaultObjectAlignment)
+	for _, opt := range opts {
+		if value, ok := strings.CutPrefix(opt, "-XX:ObjectAlignmentInBytes="); ok {
+			if parsed, err := strconv.ParseUint(value, 10, 64); err == nil && parsed > 0 {
+				alignment = parsed
+			}
+		}
+	}
+	return alignment
+}
+
+// CompressedOopsLimit returns the biggest heap, that can use compressed
+// oops with given object alignment (32GB for default 8 bytes).
+func CompressedOopsLimit(alignment uint64) uint64 {
+	return 4 * GiB * alignment
+}
+
+// capCompressedOops keeps heaps, that would land just above the compressed
+// oops limit, under it. Such heaps hold less data than a capped one.
+func capCompressedOops(heap uint64, p Params) uint64 {
+	if p.NoCompressedOopsCap {
+		return heap
+	}
+	for _, opt := range p.OtherFlags {
+		if opt == "-XX:-UseCompressedOops" {
+			return heap
+		}
+	}
+	if gc := plannedGC(p, heap); gc == GCZ {
+		// ZGC never uses compressed oops
+		return heap
+	}
+
+	alignment := ObjectAlignment(p.OtherFlags)
+	limit := CompressedOopsLimit(alignment)
+	safe := limit - compressedOopsMargin
+	switch {
+	case heap <= safe:
+		return heap
+	case p.MinHeap > safe:
+		log.Warn().Str("minHeap", FormatSize(p.MinHeap)).Str("limit", FormatSize(limit)).Msg("Minimum heap doesn't allow compressed oops")
+		return heap
+	case float64(heap) < float64(limit)*uncompressedOopsFactor:
+		log.Warn().
+			Str("heap", FormatSize(heap/MiB*MiB)).
+			Str("cappedHeap", FormatSize(safe)).
+			Uint64("objectAlignment", alignment).
+			Msg("Heap would lose compressed oops and hold less data than a smaller one, capping it")
+		return safe
+	case heap <= CompressedOopsLimit(alignment*2)-compressedOopsMargin:
+		log.Warn().
+			Str("heap", FormatSize(heap/MiB*MiB)).
+			Str("suggestion", fmt.Sprintf("-XX:ObjectAlignmentInBytes=%d", alignment*2)).
+			Msg("Heap is too big for compressed oops, bigger object alignment would keep them")
+	}
+	return heap
+}
+
+// plannedGC predicts the garbage collector, that will be used with given
+// heap size.
+func plannedGC(p Params, heap uint64) string {
+	if gc := UserGC(p.OtherFlags); gc != "" {
+		return gc
+	}
+	if gc := strings.ToLower(p.GC); gc != "" && gc != GCAuto && SupportsGC(gc, p.JavaVersion, p.Vendor) {
+		return gc
+	}
+	return SelectGC(p.JavaVersion, p.Vendor, p.CPUCount, p.MemLimit, heap)
+}
@@ -0,0 +1,185 @@
+package tuner
+
+import (
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Origins of JVM options, from the lowest to the highest precedence.
+const (
+	OriginDefault = "default" // calculated by java-tuner
+	OriginProfile = "profile" // set by the profile of the Java version
+	OriginUser    = "user"    // passed with --opts
+)
+
+var originPrecedence = map[string]int{
+	OriginDefault: 0,
+	OriginProfile: 1,
+	OriginUser:    2,
+}
+
+// Kinds of JVM options.
+const (
+	KindXXSwitch = "xx-switch" // -XX:+Name or -XX:-Name
+	KindXXValue  = "xx-value"  // -XX:Name=value
+	KindProperty = "property"  // -Dname=value
+	KindXSize    = "x-size"    // -Xmx512m, -Xms, -Xss, -Xmn
+	KindX        = "x"         // other -X options, e.g. -Xshare:off
+	KindModule   = "module"    // --add-opens and similar, repeatable
+	KindAgent    = "agent"     // -javaagent, -agentlib, -agentpath
+	KindOther    = "other"
+)
+
+// Options, that might be given many times, each one is kept.
+var repeatableOptions = []string{
+	"--add-opens",
+	"--add-exports",
+	"--add-reads",
+	"--add-modules",
+	"--patch-module",
+	"-Xlog",
+	"-Xbootclasspath",
+}
+
+// Option is a parsed JVM option. Options with the same Key set the same
+// JVM setting, so only one of them is used.
+type Option struct {
+	Kind   string
+	Name   string // e.g. MaxRAMPercentage, Xmx or the property name
+	Value  string
+	Raw    string
+	Origin string
+}
+
+// ParseOption recognizes the kind, name and value of a JVM option.
+func ParseOption(raw, origin string) Option {
+	opt := Option{Kind: KindOther, Name: raw, Raw: raw, Origin: origin}
+	switch {
+	case strings.HasPrefix(raw, "-XX:+"), strings.HasPrefix(raw, "-XX:-"):
+		opt.Kind, opt.Name, opt.Value = KindXXSwitch, raw[5:], raw[4:5]
+	case strings.HasPrefix(raw, "-XX:"):
+		opt.Kind = KindXXValue
+		opt.Name, opt.Value, _ = strings.Cut(raw[4:], "=")
+	case strings.HasPrefix(raw, "-D"):
+		opt.Kind = KindProperty
+		opt.Name, opt.Value, _ = strings.Cut(raw[2:], "=")
+	case xSizePrefix.MatchString(raw):
+		opt.Kind, opt.Name, opt.Value = KindXSize, raw[1:4], raw[4:]
+	case strings.HasPrefix(raw, "-X"):
+		opt.Kind = KindX
+		opt.Name, opt.Value, _ = strings.Cut(raw[1:], ":")
+	case strings.HasPrefix(raw, "-javaagent:"), strings.HasPrefix(raw, "-agentlib:"), strings.HasPrefix(raw, "-agentpath:"):
+		// the same agent can't be loaded twice, options differ
+		opt.Kind = KindAgent
+		opt.Name, opt.Value, _ = strings.Cut(raw[1:], "=")
+	case strings.HasPrefix(raw, "--"):
+		opt.Kind = KindModule
+		opt.Name, opt.Value, _ = strings.Cut(raw[2:], "=")
+	}
+	return opt
+}
+
+// ParseOptions parses the options, joining options with separate values
+// like `--add-opens java.base/java.lang=ALL-UNNAMED` into one.
+func ParseOptions(raw []string, origin string) []Option {
+	opts := []Option{}
+	for i := 0; i < len(raw); i++ {
+		arg := raw[i]
+		if isRepeatable(arg) && strings.HasPrefix(arg, "--") && !strings.Contains(arg, "=") && i+1 < len(raw) {
+			i++
+			arg += "=" + raw[i]
+		}
+		opts = append(opts, ParseOption(arg, origin))
+	}
+	return opts
+}
+
+// Key identifies the JVM setting changed by the option.
+func (o Option) Key() string {
+	switch o.Kind {
+	case KindXXSwitch, KindXXValue:
+		return "-XX:" + o.Name
+	case KindProperty:
+		return "-D" + o.Name
+	case KindXSize, KindX:
+		if isRepeatable("-" + o.Name) {
+			return o.Raw
+		}
+		return "-" + o.Name
+	case KindAgent:
+		return "-" + o.Name
+	}
+	return o.Raw
+}
+
+func (o Option) String() string {
+	return o.Raw
+}
+
+// MergeOptions merges the options into a deterministic list with one
+// option per Key. Options with higher precedence origin win, for equal
+// ones the last one wins. The winner takes the place of the first option
+// with the same Key.
+func MergeOptions(opts ...[]Option) []Option {
+	merged := []Option{}
+	index := map[string]int{}
+	for _, group := range opts {
+		for _, opt := range group {
+			i, seen := index[opt.Key()]
+			if !seen {
+				index[opt.Key()] = len(merged)
+				merged = append(merged, opt)
+				continue
+			}
+			current := merged[i]
+			if originPrecedence[opt.Origin] < originPrecedence[current.Origin] {
+				log.Debug().Str("option", opt.Raw).Str("origin", opt.Origin).Str("winner", current.Raw).Str("winnerOrigin", current.Origin).Msg("JVM option overridden")
+				continue
+			}
+			if opt.Raw != current.Raw {
+				log.Debug().Str("option", current.Raw).Str("origin", current.Origin).Str("winner", opt.Raw).Str("winnerOrigin", opt.Origin).Msg("JVM option overridden")
+			}
+			merged[i] = opt
+		}
+	}
+	return merged
+}
+
+func isRepeatable(arg string) bool {
+	for _, prefix := range repeatableOptions {
+		if arg == prefix || strings.HasPrefix(arg, prefix+"=") || strings.HasPrefix(arg, prefix+":") || strings.HasPrefix(arg, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveOptions drops options matching any of the patterns, see
+// matchOption. It returns kept and removed options.
+func RemoveOptions(opts []string, patterns []string) ([]string, []string) {
+	kept, removed := []string{}, []string{}
+	for _, raw := range opts {
+		pattern := matchOption(raw, patterns)
+		if pattern == "" {
+			kept = append(kept, raw)
+			continue
+		}
+		log.Info().Str("option", raw).Str("pattern", pattern).Msg("Removed JVM option")
+		removed = append(removed, raw)
+	}
+	return kept, removed
+}
+
+// matchOption returns the first pattern matching the option. A pattern
+// is an exact option, an option name (e.g. -Xshare or -XX:MaxRAM) or a glob
+// pattern (e.g. -XX:*StringDeduplication).
+func matchOption(raw string, patterns []string) string {
+	key := ParseOption(raw, OriginDefault).Key()
+	for _, pattern := range patterns {
+		if matchesAny(raw, []string{pattern}) || matchesAny(key, []string{pattern}) {
+			return pattern
+		}
+	}
+	return ""
+}
@@ -0,0 +1,174 @@
+package tuner
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// Policy modes.
+const (
+	PolicyEnforce = "enforce" // violations prevent starting Java
+	PolicyAudit   = "audit"   // violations are only reported
+)
+
+// Policy holds organisation constraints on the final JVM options.
+type Policy struct {
+	Mode      string        `mapstructure:"mode"`
+	Required  []PolicyRule  `mapstructure:"required"`
+	Forbidden []PolicyRule  `mapstructure:"forbidden"`
+	Ranges    []PolicyRange `mapstructure:"ranges"`
+}
+
+// PolicyRule matches options by an exact option, option name or glob
+// pattern, same as --remove-opt.
+type PolicyRule struct {
+	Pattern string `mapstructure:"pattern"`
+	Reason  string `mapstructure:"reason"`
+}
+
+// PolicyRange limits the value of an option, e.g. -XX:MaxRAMPercentage or
+// -Xmx. Min and Max are numbers or sizes (512m), empty ones are not
+// checked. Options not set are not checked either.
+type PolicyRange struct {
+	Option string `mapstructure:"option"`
+	Min    string `mapstructure:"min"`
+	Max    string `mapstructure:"max"`
+	Reason string `mapstructure:"reason"`
+}
+
+// PolicyViolation describes an option breaking the policy.
+type PolicyViolation struct {
+	Option  string
+	Message string
+	Reason  string
+}
+
+func (v PolicyViolation) Error() string {
+	if v.Reason == "" {
+		return v.Message
+	}
+	return v.Message + ": " + v.Reason
+}
+
+// LoadPolicy reads a policy from a YAML, JSON or TOML file.
+func LoadPolicy(path string) (Policy, error) {
+	config := viper.New()
+	config.SetConfigFile(path)
+	config.SetDefault("mode", PolicyEnforce)
+	if err := config.ReadInConfig(); err != nil {
+		return Policy{}, fmt.Errorf("could not read policy %s: %w", path, err)
+	}
+	policy := Policy{}
+	if err := config.Unmarshal(&policy); err != nil {
+		return policy, fmt.Errorf("could not parse policy %s: %w", path, err)
+	}
+	if policy.Mode != PolicyEnforce && policy.Mode != PolicyAudit {
+		return policy, fmt.Errorf("unknown mode %q in policy %s, use enforce or audit", policy.Mode, path)
+	}
+	for _, r := range policy.Ranges {
+		for _, bound := range []string{r.Min, r.Max} {
+			if _, err := parseNumber(bound); bound != "" && err != nil {
+				return policy, fmt.Errorf("invalid range of %s in policy %s: %w", r.Option, path, err)
+			}
+		}
+	}
+	log.Debug().Str("file", path).Str("mode", policy.Mode).Msg("Loaded policy")
+	return policy, nil
+}
+
+// heapSizeOptions set the heap size directly, instead of the percentage of
+// memory, and take precedence over the percentage.
+var heapSizeOptions = map[string][]string{
+	"-XX:MaxRAMPercentage":     {"-Xmx", "-XX:MaxHeapSize"},
+	"-XX:InitialRAMPercentage": {"-Xms", "-XX:InitialHeapSize"},
+}
+
+// Evaluate checks the final JVM options against the policy. Ranges of RAM
+// percentages are also checked for heap sizes set directly, e.g. with -Xmx,
+// as the percentage of -XX:MaxRAM or memLimit. Zero memLimit skips it.
+func (p Policy) Evaluate(opts []string, memLimit uint64) []PolicyViolation {
+	violations := []PolicyViolation{}
+	for _, rule := range p.Required {
+		if !slices.ContainsFunc(opts, func(opt string) bool { return matchOption(opt, []string{rule.Pattern}) != "" }) {
+			violations = append(violations, PolicyViolation{
+				Option:  rule.Pattern,
+				Message: fmt.Sprintf("required option %s is missing", rule.Pattern),
+				Reason:  rule.Reason,
+			})
+		}
+	}
+	for _, rule := range p.Forbidden {
+		for _, opt := range opts {
+			if matchOption(opt, []string{rule.Pattern}) == "" {
+				continue
+			}
+			violations = append(violations, PolicyViolation{
+				Option:  opt,
+				Message: fmt.Sprintf("option %s is forbidden", opt),
+				Reason:  rule.Reason,
+			})
+		}
+	}
+
+	parsed := ParseOptions(opts, OriginDefault)
+	memory := memLimit
+	for _, opt := range parsed {
+		if opt.Key() != "-XX:MaxRAM" {
+			continue
+		}
+		if size, err := ParseSize(opt.Value); err == nil {
+			memory = size
+		}
+	}
+	for _, r := range p.Ranges {
+		for _, opt := range parsed {
+			if opt.Key() == r.Option {
+				if msg := r.check(opt.Value); msg != "" {
+					violations = append(violations, PolicyViolation{Option: opt.Raw, Message: fmt.Sprintf("option %s %s", opt.Raw, msg), Reason: r.Reason})
+				}
+				continue
+			}
+			size, err := ParseSize(opt.Value)
+			if !slices.Contains(heapSizeOptions[r.Option], opt.Key()) || err != nil || memory == 0 {
+				continue
+			}
+			percentage := strconv.FormatFloat(float64(size)/float64(memory)*100, 'f', 1, 64)
+			if msg := r.check(percentage); msg != "" {
+				violations = append(violations, PolicyViolation{
+					Option:  opt.Raw,
+					Message: fmt.Sprintf("option %s sets %s%% of memory, its %s %s", opt.Raw, percentage, r.Option, msg),
+					Reason:  r.Reason,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// check returns why the value is out of the range, or an empty string.
+func (r PolicyRange) check(value string) string {
+	v, err := parseNumber(value)
+	if err != nil {
+		return fmt.Sprintf("has value %q, that can't be compared with the allowed range", value)
+	}
+	if lower, err := parseNumber(r.Min); r.Min != "" && err == nil && v < lower {
+		return "is below the minimum " + r.Min
+	}
+	if upper, err := parseNumber(r.Max); r.Max != "" && err == nil && v > upper {
+		return "is above the maximum " + r.Max
+	}
+	return ""
+}
+
+// parseNumber parses plain numbers and sizes.
+func parseNumber(s string) (float64, error) {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, nil
+	}
+	size, err := ParseSize(s)
+	return float64(size), err
+}
@@ -0,0 +1,189 @@
+package tuner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CrashFiles tells where the JVM writes files, when it crashes or runs out
+// of memory. %p in paths is replaced with the pid by the JVM.
+type CrashFiles struct {
+	ErrorFile    string // -XX:ErrorFile, hs_err_pid%p.log in the working directory by default
+	ReplayFile   string // -XX:ReplayDataFile, written on JIT compiler crashes
+	HeapDumpPath string // -XX:HeapDumpPath, a directory or a file
+}
+
+// PostMortemOptions points crash files of the JVM into dir, so they can be
+// found after it dies. Options already set in opts are kept.
+func PostMortemOptions(opts []string, dir string) []string {
+	set := map[string]bool{}
+	for _, opt := range ParseOptions(opts, OriginDefault) {
+		set[opt.Key()] = true
+	}
+	defaults := []string{
+		"-XX:ErrorFile=" + filepath.Join(dir, "hs_err_pid%p.log"),
+		"-XX:ReplayDataFile=" + filepath.Join(dir, "replay_pid%p.log"),
+		"-XX:HeapDumpPath=" + dir,
+	}
+	for _, opt := range defaults {
+		if key := ParseOption(opt, OriginDefault).Key(); !set[key] {
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
+
+// CrashFilesOf reads locations of crash files from JVM options.
+func CrashFilesOf(opts []string) CrashFiles {
+	files := CrashFiles{}
+	for _, opt := range ParseOptions(opts, OriginDefault) {
+		switch opt.Key() {
+		case "-XX:ErrorFile":
+			files.ErrorFile = opt.Value
+		case "-XX:ReplayDataFile":
+			files.ReplayFile = opt.Value
+		case "-XX:HeapDumpPath":
+			files.HeapDumpPath = opt.Value
+		}
+	}
+	return files
+}
+
+// Find returns crash files left by the JVM with pid, modified after since.
+// Besides configured paths, the JVM falls back to the working directory
+// and the temporary one.
+func (f CrashFiles) Find(pid int, since time.Time) []string {
+	p := strconv.Itoa(pid)
+	expand := func(path string) string { return strings.ReplaceAll(path, "%p", p) }
+	candidates := []string{
+		"hs_err_pid" + p + ".log",
+		filepath.Join(os.TempDir(), "hs_err_pid"+p+".log"),
+		"replay_pid" + p + ".log",
+		"java_pid" + p + ".hprof",
+	}
+	if f.ErrorFile != "" {
+		candidates = append(candidates, expand(f.ErrorFile))
+	}
+	if f.ReplayFile != "" {
+		candidates = append(candidates, expand(f.ReplayFile))
+	}
+	if f.HeapDumpPath != "" {
+		path := expand(f.HeapDumpPath)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, "java_pid"+p+".hprof")
+		}
+		candidates = append(candidates, path)
+	}
+
+	found := []string{}
+	seen := map[string]bool{}
+	for _, path := range candidates {
+		abs, err := filepath.Abs(path)
+		if err != nil || seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		if info, err := os.Stat(abs); err == nil && !info.IsDir() && !info.ModTime().Before(since) {
+			found = append(found, abs)
+		}
+	}
+	return found
+}
+
+// CrashReport is the summary of a hs_err file.
+type CrashReport struct {
+	Error            string // signal or the reason, e.g. insufficient memory
+	ProblematicFrame string
+	JREVersion       string
+	JavaVM           string
+	Memory           string // physical memory and swap
+	Heap             string // heap usage at the time of the crash
+}
+
+var hsErrSignal = regexp.MustCompile(`^#\s+((SIG[A-Z]+|EXCEPTION_[A-Z_]+) \(0x[0-9a-f]+\).*)$`)
+
+// ParseErrorFile reads the summary of a hs_err file written by a crashed
+// JVM.
+func ParseErrorFile(path string) (CrashReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return CrashReport{}, fmt.Errorf("could not read error file %s: %w", path, err)
+	}
+	defer file.Close()
+	return parseErrorFile(file), nil
+}
+
+func parseErrorFile(r io.Reader) CrashReport {
+	report := CrashReport{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	previous := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		switch {
+		case report.Error == "" && hsErrSignal.MatchString(line):
+			report.Error = hsErrSignal.FindStringSubmatch(line)[1]
+		case report.Error == "" && strings.HasPrefix(line, "# There is insufficient memory"):
+			report.Error = trimmed
+		case strings.HasPrefix(line, "# Native memory allocation"):
+			report.Error += " " + trimmed
+		case strings.HasPrefix(line, "# JRE version:"):
+			report.JREVersion = strings.TrimSpace(strings.TrimPrefix(trimmed, "JRE version:"))
+		case strings.HasPrefix(line, "# Java VM:"):
+			report.JavaVM = strings.TrimSpace(strings.TrimPrefix(trimmed, "Java VM:"))
+		case strings.HasPrefix(previous, "# Problematic frame:"):
+			report.ProblematicFrame = trimmed
+		case report.Memory == "" && strings.HasPrefix(line, "Memory:"):
+			report.Memory = strings.TrimSpace(strings.TrimPrefix(line, "Memory:"))
+		case report.Heap == "" && previous == "Heap:":
+			report.Heap = strings.Join(strings.Fields(line), " ")
+		}
+		previous = line
+	}
+	report.Error = strings.TrimSpace(report.Error)
+	return report
+}
+
+// CopyCrashFiles copies crash files into a new directory in dir, named
+// after the time and pid, e.g. to keep them on a persistent volume. It
+// returns the directory.
+func CopyCrashFiles(files []string, dir string, pid int) (string, error) {
+	target := filepath.Join(dir, fmt.Sprintf("%s-pid%d", time.Now().UTC().Format("20060102T150405Z"), pid))
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		return "", err
+	}
+	for _, path := range files {
+		if err := copyFile(path, filepath.Join(target, filepath.Base(path))); err != nil {
+			return target, fmt.Errorf("could not copy %s: %w", path, err)
+		}
+		log.Debug().Str("file", path).Str("dir", target).Msg("Copied crash file")
+	}
+	return target, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,235 @@
+package tuner
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Kinds of relations between JVM options.
+const (
+	// RuleRequires adds the other option before the matching one, or drops
+	// the matching one when there are many alternatives to choose from.
+	RuleRequires = "requires"
+	// RuleConflicts drops the matching option when any of the others is
+	// set. Within a group of mutually exclusive options the last one wins.
+	RuleConflicts = "conflicts"
+	// RuleSupersedes drops the other options, as JVM ignores them when the
+	// matching one is set.
+	RuleSupersedes = "supersedes"
+)
+
+// Rule describes a relation between JVM options. Options and Others are
+// glob patterns, e.g. -Xmx* or -XX:MaxRAMPercentage=*. The rule is applied
+// only to Java versions between MinVersion (included) and MaxVersion
+// (excluded), when set.
+type Rule struct {
+	Kind       string
+	Options    []string
+	Others     []string
+	MinVersion string
+	MaxVersion string
+	Reason     string
+}
+
+var collectorFlags = []string{
+	"-XX:+UseSerialGC",
+	"-XX:+UseParallelGC",
+	"-XX:+UseG1GC",
+	"-XX:+UseZGC",
+	"-XX:+UseShenandoahGC",
+	"-XX:+UseConcMarkSweepGC",
+	"-XX:+UseEpsilonGC",
+}
+
+// Rules are applied in order on the merged JVM options.
+var Rules = []Rule{
+	{
+		Kind:    RuleConflicts,
+		Options: collectorFlags,
+		Others:  collectorFlags,
+		Reason:  "only one garbage collector can be selected",
+	},
+	{
+		Kind:       RuleConflicts,
+		Options:    []string{"-XX:+UseStringDeduplication"},
+		Others:     []string{"-XX:+UseSerialGC", "-XX:+UseParallelGC", "-XX:+UseConcMarkSweepGC", "-XX:+UseEpsilonGC"},
+		MinVersion: "v1.8",
+		MaxVersion: "v18",
+		Reason:     "string deduplication is supported only by G1 and Shenandoah before Java 18",
+	},
+	{
+		Kind:    RuleSupersedes,
+		Options: []string{"-Xmx*", "-XX:MaxHeapSize=*"},
+		Others:  []string{"-XX:MaxRAMPercentage=*", "-XX:MinRAMPercentage=*", "-XX:MaxRAMFraction=*", "-XX:MinRAMFraction=*"},
+		Reason:  "absolute max heap size takes precedence over the percentage of RAM",
+	},
+	{
+		Kind:    RuleSupersedes,
+		Options: []string{"-Xms*", "-XX:InitialHeapSize=*"},
+		Others:  []string{"-XX:InitialRAMPercentage=*", "-XX:InitialRAMFraction=*"},
+		Reason:  "absolute initial heap size takes precedence over the percentage of RAM",
+	},
+	{
+		Kind:       RuleRequires,
+		Options:    []string{"-XX:+UseCGroupMemoryLimitForHeap"},
+		Others:     []string{"-XX:+UnlockExperimentalVMOptions"},
+		MinVersion: "v1.8",
+		MaxVersion: "v10",
+		Reason:     "the option is experimental",
+	},
+	{
+		Kind:       RuleRequires,
+		Options:    []string{"-XX:+UseZGC"},
+		Others:     []string{"-XX:+UnlockExperimentalVMOptions"},
+		MinVersion: "v11",
+		MaxVersion: "v15",
+		Reason:     "ZGC is experimental before Java 15",
+	},
+	{
+		Kind:       RuleRequires,
+		Options:    []string{"-XX:+UseShenandoahGC"},
+		Others:     []string{"-XX:+UnlockExperimentalVMOptions"},
+		MinVersion: "v12",
+		MaxVersion: "v15",
+		Reason:     "Shenandoah is experimental before Java 15",
+	},
+}
+
+// ApplyRules resolves dependencies and conflicts between JVM options
+// and logs every change it makes.
+func ApplyRules(opts []string, javaVersion string) []string {
+	opts = slices.Clone(opts)
+	for _, rule := range Rules {
+		if !rule.appliesTo(javaVersion) {
+			continue
+		}
+		switch rule.Kind {
+		case RuleRequires:
+			opts = rule.require(opts)
+		case RuleConflicts:
+			opts = rule.resolveConflicts(opts)
+		case RuleSupersedes:
+			opts = rule.supersede(opts)
+		}
+	}
+	return opts
+}
+
+func (r Rule) appliesTo(javaVersion string) bool {
+	return (r.MinVersion == "" || versionAtLeast(javaVersion, r.MinVersion)) &&
+		(r.MaxVersion == "" || !versionAtLeast(javaVersion, r.MaxVersion))
+}
+
+func (r Rule) require(opts []string) []string {
+	resolved := []string{}
+	for _, opt := range opts {
+		if !matchesAny(opt, r.Options) || slices.ContainsFunc(resolved, func(o string) bool { return matchesAny(o, r.Others) }) {
+			resolved = append(resolved, opt)
+			continue
+		}
+		if len(r.Others) == 1 && !isPattern(r.Others[0]) {
+			log.Info().Str("option", opt).Str("required", r.Others[0]).Str("reason", r.Reason).Msg("Adding required JVM option")
+			resolved = append(resolved, r.Others[0], opt)
+			continue
+		}
+		log.Warn().Str("option", opt).Strs("required", r.Others).Str("reason", r.Reason).Msg("Dropped JVM option without required option")
+	}
+	return resolved
+}
+
+func (r Rule) resolveConflicts(opts []string) []string {
+	mutual := slices.Equal(r.Options, r.Others)
+	resolved := []string{}
+	for i, opt := range opts {
+		if !matchesAny(opt, r.Options) {
+			resolved = append(resolved, opt)
+			continue
+		}
+		conflict := ""
+		for j, other := range opts {
+			// within a group of mutually exclusive options only the later
+			// ones conflict, so the last one wins
+			if other == opt || !matchesAny(other, r.Others) || (mutual && j < i) {
+				continue
+			}
+			conflict = other
+			break
+		}
+		if conflict == "" {
+			resolved = append(resolved, opt)
+			continue
+		}
+		log.Warn().Str("option", opt).Str("conflict", conflict).Str("reason", r.Reason).Msg("Dropped conflicting JVM option")
+	}
+	return resolved
+}
+
+func (r Rule) supersede(opts []string) []string {
+	superseding := slices.IndexFunc(opts, func(o string) bool { return matchesAny(o, r.Options) })
+	if superseding < 0 {
+		return opts
+	}
+	resolved := []string{}
+	for _, opt := range opts {
+		if matchesAny(opt, r.Others) {
+			log.Info().Str("option", opt).Str("supersededBy", opts[superseding]).Str("reason", r.Reason).Msg("Dropped superseded JVM option")
+			continue
+		}
+		resolved = append(resolved, opt)
+	}
+	return resolved
+}
+
+func matchesAny(opt string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if globMatch(pattern, opt) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches s with a glob pattern. Unlike path.Match, * matches any
+// characters, also /, as option values are often paths, e.g. in
+// -javaagent:/opt/agent.jar. ? matches a single character and [...] a class.
+func globMatch(pattern, s string) bool {
+	var expr strings.Builder
+	expr.WriteString("(?s)^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	return err == nil && re.MatchString(s)
+}
+
+func isPattern(s string) bool {
+	return slices.ContainsFunc([]rune(s), func(r rune) bool { return r == '*' || r == '?' || r == '[' })
+}
@@ -0,0 +1,72 @@
+package tuner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	KiB uint64 = 1024
+	MiB        = 1024 * KiB
+	GiB        = 1024 * MiB
+	TiB        = 1024 * GiB
+)
+
+var sizeUnits = map[string]uint64{
+	"":   1,
+	"b":  1,
+	"k":  KiB,
+	"ki": KiB,
+	"kb": KiB,
+	"m":  MiB,
+	"mi": MiB,
+	"mb": MiB,
+	"g":  GiB,
+	"gi": GiB,
+	"gb": GiB,
+	"t":  TiB,
+	"ti": TiB,
+	"tb": TiB,
+}
+
+// ParseSize parses human readable sizes like 512m, 512Mi or 2G. Units
+// are binary, as in JVM options, so 1G and 1Gi are both 1024^3 bytes.
+func ParseSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(s[i:])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q", s)
+	}
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	return uint64(value * float64(unit)), nil
+}
+
+// FormatSize formats bytes using the largest unit that represents it
+// exactly, in a form accepted by JVM options (e.g. 512m or 2g).
+func FormatSize(bytes uint64) string {
+	switch {
+	case bytes == 0:
+		return "0"
+	case bytes%GiB == 0:
+		return fmt.Sprintf("%dg", bytes/GiB)
+	case bytes%MiB == 0:
+		return fmt.Sprintf("%dm", bytes/MiB)
+	case bytes%KiB == 0:
+		return fmt.Sprintf("%dk", bytes/KiB)
+	}
+	return strconv.FormatUint(bytes, 10)
+}
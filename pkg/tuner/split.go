@@ -0,0 +1,116 @@
+package tuner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SplitOpts splits options into words the way a POSIX shell does, so
+// `-Dapp.banner="hello world"` stays a single option. Single and double
+// quotes and backslash escapes are supported. Nothing is expanded:
+// variables are kept as they are and command substitution is rejected.
+func SplitOpts(s string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '\\':
+			inWord = true
+			if i+1 == len(runes) {
+				return nil, errors.New("unfinished escape at the end of options")
+			}
+			i++
+			if runes[i] != '\n' { // line continuation
+				word.WriteRune(runes[i])
+			}
+		case r == '\'':
+			inWord = true
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote at position %d", i)
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			i = end
+		case r == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '"' {
+					closed = true
+					break
+				}
+				if err := checkSubstitution(runes, i); err != nil {
+					return nil, err
+				}
+				// only those characters can be escaped in double quotes
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, errors.New("unterminated double quote")
+			}
+		default:
+			if err := checkSubstitution(runes, i); err != nil {
+				return nil, err
+			}
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// JoinOpts is the inverse of SplitOpts, it joins words with spaces, quoting
+// the ones with whitespace, quotes or other special characters in single
+// quotes, so they are split back the same way by SplitOpts and the JVM.
+func JoinOpts(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, quoteOpt(word))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func quoteOpt(word string) string {
+	if word != "" && !strings.ContainsAny(word, " \t\n'\"\\$`") {
+		return word
+	}
+	// a single quote can't be escaped within single quotes, so it's put
+	// between them in double quotes
+	return "'" + strings.ReplaceAll(word, "'", `'"'"'`) + "'"
+}
+
+func checkSubstitution(runes []rune, i int) error {
+	if runes[i] == '`' || (runes[i] == '$' && i+1 < len(runes) && runes[i+1] == '(') {
+		return fmt.Errorf("command substitution is not supported, at position %d", i)
+	}
+	return nil
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,50 @@
+package tuner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	xxBoolSyntax  = regexp.MustCompile(`^-XX:[+-][A-Za-z][A-Za-z0-9_]*$`)
+	xxValueSyntax = regexp.MustCompile(`^-XX:[A-Za-z][A-Za-z0-9_]*=.*$`)
+	xSizeSyntax   = regexp.MustCompile(`^-X(mx|ms|ss|mn)[0-9]+[kKmMgGtT]?$`)
+	xSizePrefix   = regexp.MustCompile(`^-X(mx|ms|ss|mn)`)
+	xOtherSyntax  = regexp.MustCompile(`^-X[a-z][A-Za-z0-9/]*(:.+)?$`)
+	sysPropSyntax = regexp.MustCompile(`^-D[^=\s]+(=.*)?$`)
+	agentSyntax   = regexp.MustCompile(`^-(javaagent|agentlib|agentpath):.+$`)
+	longSyntax    = regexp.MustCompile(`^--[a-z][a-z-]*(=.+)?$`)
+	shortSyntax   = regexp.MustCompile(`^-[a-z][A-Za-z-]*(:.+)?$`)
+)
+
+// ValidateSyntax checks if a JVM option is well formed. It doesn't check
+// if the JVM knows the option, only if it would be able to parse it.
+func ValidateSyntax(opt string) error {
+	switch {
+	case strings.TrimSpace(opt) != opt || opt == "":
+		return fmt.Errorf("option %q is empty or has surrounding whitespace", opt)
+	case strings.HasPrefix(opt, "-XX:"):
+		if xxBoolSyntax.MatchString(opt) || xxValueSyntax.MatchString(opt) {
+			return nil
+		}
+		return fmt.Errorf("option %q should be in -XX:+Name, -XX:-Name or -XX:Name=value form", opt)
+	case xSizePrefix.MatchString(opt):
+		if xSizeSyntax.MatchString(opt) {
+			return nil
+		}
+		return fmt.Errorf("option %q should be followed directly by a size, e.g. %s512m", opt, xSizePrefix.FindString(opt))
+	case strings.HasPrefix(opt, "-X"):
+		if xOtherSyntax.MatchString(opt) {
+			return nil
+		}
+	case strings.HasPrefix(opt, "-D"):
+		if sysPropSyntax.MatchString(opt) {
+			return nil
+		}
+		return fmt.Errorf("option %q should be in -Dname=value form", opt)
+	case agentSyntax.MatchString(opt), longSyntax.MatchString(opt), shortSyntax.MatchString(opt):
+		return nil
+	}
+	return fmt.Errorf("option %q is not a valid JVM option", opt)
+}
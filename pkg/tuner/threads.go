@@ -0,0 +1,105 @@
+package tuner
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// JVM uses all CPUs for parallel GC work up to 8, then 5/8 of the rest.
+	parallelGCThreadsSwitch = 8
+	// Tiered compilation needs at least one C1 and one C2 thread.
+	minCICompilerCountTiered = 2
+	minCICompilerCount       = 1
+	maxCICompilerCount       = 12
+)
+
+// ParallelGCThreads follows the JVM formula, but counts only whole CPUs
+// available to the container, so fractional quota doesn't lead to more
+// GC threads than CPU time.
+func ParallelGCThreads(cpuQuota float64) int {
+	cpus := max(int(math.Floor(cpuQuota)), 1)
+	if cpus <= parallelGCThreadsSwitch {
+		return cpus
+	}
+	return parallelGCThreadsSwitch + (cpus-parallelGCThreadsSwitch)*5/8
+}
+
+// ConcGCThreads returns number of threads for concurrent GC phases,
+// which work alongside application threads.
+func ConcGCThreads(parallelGCThreads int) int {
+	return max((parallelGCThreads+2)/4, 1)
+}
+
+// CICompilerCount follows the JVM formula for JIT compiler threads, with
+// a floor required by tiered compilation and a cap that stops compilation
+// from starving application threads.
+func CICompilerCount(cpuQuota float64, javaVersion string) int {
+	minCount := minCICompilerCount
+	if versionAtLeast(javaVersion, "v1.8") {
+		// tiered compilation is enabled by default since Java 8
+		minCount = minCICompilerCountTiered
+	}
+
+	cpus := max(int(math.Ceil(cpuQuota)), 1)
+	logCPU := bits.Len(uint(cpus)) - 1
+	logLogCPU := bits.Len(uint(max(logCPU, 1))) - 1
+	count := logCPU * logLogCPU * 3 / 2
+
+	return min(max(count, minCount), maxCICompilerCount)
+}
+
+// tuneCPU limits the number of processors visible to the JVM. Runtimes
+// without -XX:ActiveProcessorCount get the common ForkJoinPool sized
+// instead, GC and compiler threads are sized by tuneThreads either way.
+func tuneCPU(p Params, defaults ConfigSet) []string {
+	if defaults.activeProcessorCount {
+		log.Debug().Int("cpuCount", p.CPUCount).Msg("Using CPU count for ActiveProcessorCount")
+		return []string{fmt.Sprintf("-XX:ActiveProcessorCount=%d", p.CPUCount)}
+	}
+
+	log.Warn().
+		Str("version", p.JavaVersion).
+		Msg("JVM doesn't support -XX:ActiveProcessorCount, Runtime.availableProcessors() will still report host CPUs")
+	if p.CPUCount <= 0 || !versionAtLeast(p.JavaVersion, "v1.8") {
+		// common ForkJoinPool was added in Java 8
+		return []string{}
+	}
+	// same as JVM default, one thread less than available processors
+	parallelism := max(p.CPUCount-1, 1)
+	log.Debug().Int("parallelism", parallelism).Msg("Using CPU count for common ForkJoinPool parallelism")
+	return []string{fmt.Sprintf("-Djava.util.concurrent.ForkJoinPool.common.parallelism=%d", parallelism)}
+}
+
+// tuneThreads sizes GC and JIT compiler threads for the CPU quota and
+// selected garbage collector.
+func tuneThreads(p Params, gc string) []string {
+	quota := p.CPUQuota
+	if quota <= 0 {
+		quota = float64(p.CPUCount)
+	}
+	if quota <= 0 {
+		log.Debug().Msg("CPU quota unknown, leaving thread counts to the JVM")
+		return []string{}
+	}
+
+	opts := []string{}
+	switch gc {
+	case GCParallel, GCG1, GCZ, GCShenandoah, GCCMS:
+		parallel := ParallelGCThreads(quota)
+		opts = append(opts, fmt.Sprintf("-XX:ParallelGCThreads=%d", parallel))
+		if gc != GCParallel {
+			opts = append(opts, fmt.Sprintf("-XX:ConcGCThreads=%d", ConcGCThreads(parallel)))
+		}
+	default:
+		// SerialGC is single threaded
+		log.Debug().Str("gc", gc).Msg("Skipping GC thread counts")
+	}
+
+	opts = append(opts, fmt.Sprintf("-XX:CICompilerCount=%d", CICompilerCount(quota, p.JavaVersion)))
+	log.Debug().Float64("cpuQuota", quota).Strs("opts", opts).Msg("Sized GC and compiler threads")
+	return opts
+}
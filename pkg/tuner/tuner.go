@@ -2,23 +2,62 @@ package tuner
 
 import (
 	"fmt"
-	"strings"
+	"strconv"
 
 	"github.com/rs/zerolog/log"
 	"github.com/tgagor/java-tuner/pkg/runner"
 	"golang.org/x/mod/semver"
 )
 
-// Options holds calculated JVM options.
+// Options holds calculated JVM options, grouped by their purpose and
+// origin.
 type Options struct {
-	MemoryOpts []string
-	CPUOpts    []string
-	OtherOpts  []string
+	MemoryOpts  []string
+	CPUOpts     []string
+	GCOpts      []string
+	ProfileOpts []string // from the profile of the Java version
+	UserOpts    []string // passed by the user, they take precedence
 }
 
-// DetectResources reads env vars and returns CPU/mem info.
-func DetectResources(cpuCount int, memPercentage float64, opts string) (javaVersion string, finalCpuCount int, memLimit uint64, finalMemPercentage float64, finalOpts []string, err error) {
-	cmd := runner.New("java").Arg("-version")
+// Params describes the runtime environment and user choices, that Tune
+// bases its calculations on.
+type Params struct {
+	JavaBin       string
+	JavaVersion   string
+	Vendor        string
+	CPUCount      int
+	CPUQuota      float64
+	MemLimit      uint64
+	MemPercentage float64
+	MemBreakpoint string // curve breakpoint that selected MemPercentage
+	MinHeap       uint64
+	MaxHeap       uint64
+	Headroom      uint64
+	// NoCompressedOopsCap allows heaps just above the compressed oops limit
+	NoCompressedOopsCap bool
+	// StrictVersion fails on Java versions not covered by any profile,
+	// instead of falling back to the nearest one
+	StrictVersion bool
+	GC            string
+	Calculator    MemoryCalculator
+	ScanClasspath bool
+	// ClassScan is set by DetectResources, when the classpath was scanned
+	ClassScan  *ClassScan
+	OtherFlags []string
+	// Blacklist is applied to OtherFlags, DefaultBlacklist when nil
+	Blacklist []BlacklistRule
+	Args      []string // passed to Java after JVM options
+}
+
+// DetectResources fills in the unset Params with detected values.
+func DetectResources(p Params) (Params, error) {
+	javaBin, err := runner.LookJava(p.JavaBin)
+	if err != nil {
+		log.Error().Err(err).Str("path", p.JavaBin).Msg("Java executable not found")
+		javaBin = "java"
+	}
+
+	cmd := runner.New(javaBin).Arg("-version")
 	versionOutput, err := cmd.Output()
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get Java version")
@@ -26,101 +65,385 @@ func DetectResources(cpuCount int, memPercentage float64, opts string) (javaVers
 	}
 	log.Debug().Str("output", versionOutput).Err(err).Msg("Java version output")
 
-	javaVersion, err = JavaVersion(versionOutput)
+	p.JavaVersion, err = JavaVersion(versionOutput)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to parse Java version")
 	}
-	log.Debug().Str("version", javaVersion).Err(err).Msg("Detected Java version")
+	log.Debug().Str("version", p.JavaVersion).Err(err).Msg("Detected Java version")
 
-	defaults := GetDefaults(javaVersion)
+	p.Vendor = JavaVendor(versionOutput)
+	log.Debug().Str("vendor", p.Vendor).Msg("Detected Java vendor")
 
-	finalCpuCount = cpuCount
-	if finalCpuCount <= 0 {
-		log.Debug().Msg("CPU count not set, detecting")
-		finalCpuCount = CPULimit()
+	defaults, err := MatchDefaults(p.JavaVersion)
+	if err != nil {
+		if p.StrictVersion {
+			return p, fmt.Errorf("no tuning profile for Java version: %w", err)
+		}
+		log.Warn().
+			Err(err).
+			Str("profile", defaults.Range()).
+			Msg("No tuning profile for this Java version, falling back to the nearest one. Use --strict-version to fail instead")
+	}
+	if !semver.IsValid(canonicalVersion(p.JavaVersion)) {
+		// version gates would treat it as the oldest Java otherwise
+		log.Warn().Str("version", p.JavaVersion).Str("assumed", defaults.MinVersion()).Msg("Unknown Java version, assuming the first version of the selected profile")
+		p.JavaVersion = defaults.MinVersion()
 	}
-	log.Debug().Int("cpuCount", finalCpuCount).Msg("Detected CPU count")
 
-	finalMemPercentage = memPercentage
-	if finalMemPercentage <= 0 {
-		log.Debug().Msg("Memory percentage not set, using default 80.0")
-		finalMemPercentage = defaults.maxRamPercentage
+	if p.CPUCount <= 0 {
+		log.Debug().Msg("CPU count not set, detecting")
+		p.CPUQuota = CPUQuota()
+		p.CPUCount = roundCPUs(p.CPUQuota)
+	} else {
+		p.CPUQuota = float64(p.CPUCount)
 	}
-	log.Debug().Float64("memPercentage", finalMemPercentage).Msg("Using memory percentage")
+	log.Debug().Int("cpuCount", p.CPUCount).Float64("cpuQuota", p.CPUQuota).Msg("Detected CPU count")
 
-	memLimit = MemoryLimit()
-	log.Debug().Uint64("memLimit", memLimit).Msg("Detected memory limit")
-	if memLimit <= 0 {
+	if p.MemLimit > 0 {
+		log.Debug().Str("memLimit", FormatSize(p.MemLimit)).Msg("Using memory limit set by user")
+	} else {
+		p.MemLimit = MemoryLimit()
+		log.Debug().Uint64("memLimit", p.MemLimit).Msg("Detected memory limit")
+	}
+	if p.MemLimit <= 0 {
 		log.Warn().Msg("Memory limit is 0, using 25% of system RAM")
-		memLimit = systemRAM() / 4 // Fallback to 25% of system RAM
-		log.Debug().Uint64("memLimit", memLimit).Msg("Using 25% of system RAM as memory limit")
+		p.MemLimit = systemRAM() / 4 // Fallback to 25% of system RAM
+		log.Debug().Uint64("memLimit", p.MemLimit).Msg("Using 25% of system RAM as memory limit")
+	}
+
+	if p.MemPercentage <= 0 {
+		log.Debug().Msg("Memory percentage not set, using heap percentage curve")
+		p.MemPercentage, p.MemBreakpoint = defaults.RAMPercentage(p.MemLimit)
+		log.Info().
+			Str("memLimit", FormatSize(p.MemLimit)).
+			Str("breakpoint", p.MemBreakpoint).
+			Float64("memPercentage", p.MemPercentage).
+			Msg("Selected heap percentage from curve")
 	}
+	log.Debug().Float64("memPercentage", p.MemPercentage).Msg("Using memory percentage")
 
-	if len(opts) != 0 {
-		// add defaults to opts
-		finalOpts = append(finalOpts, defaults.opts...)
-		// Parse opts from raw string if provided
-		finalOpts = append(finalOpts, strings.Fields(opts)...)
-		log.Debug().Strs("otherFlags", finalOpts).Msg("Using extra JVM options")
+	if len(p.OtherFlags) != 0 {
+		log.Debug().Strs("otherFlags", p.OtherFlags).Msg("Using extra JVM options")
 	} else {
 		log.Debug().Msg("No extra JVM options provided")
 	}
 
-	return
+	if p.Calculator.Enabled && p.Calculator.ClassCount <= 0 && p.ScanClasspath {
+		scan := ScanClasspath(ClasspathFromArgs(p.Args), JavaHome(javaBin))
+		log.Info().
+			Strs("entries", scan.Entries).
+			Int("appClasses", scan.AppClasses).
+			Int("jdkClasses", scan.JDKClasses).
+			Int("loadedClasses", scan.Loaded).
+			Msg("Scanned classpath")
+		p.ClassScan = &scan
+		if scan.Loaded > 0 {
+			p.Calculator.ClassCount = scan.Loaded
+		}
+	}
+
+	return p, nil
+}
+
+// HeapReductionAfterOOMKill is the part of the heap percentage kept after
+// each restart caused by the OOM killer, leaving more room for native memory.
+const HeapReductionAfterOOMKill = 0.9
+
+// ReduceHeap lowers the heap of detected Params, after the JVM was killed
+// by the OOM killer oomKills times. The memory calculator gets a bigger
+// headroom instead, by the same part of the memory limit.
+func ReduceHeap(p Params, oomKills int) Params {
+	if oomKills <= 0 {
+		return p
+	}
+	factor := 1.0
+	for range oomKills {
+		factor *= HeapReductionAfterOOMKill
+	}
+	if p.Calculator.Enabled {
+		headroom := p.Headroom + uint64(float64(p.MemLimit)*(1-factor))
+		log.Warn().
+			Str("headroom", FormatSize(p.Headroom)).
+			Str("increasedTo", FormatSize(headroom)).
+			Int("oomKills", oomKills).
+			Msg("Increased headroom after Java was OOM-killed")
+		p.Headroom = headroom
+		return p
+	}
+	log.Warn().
+		Float64("memPercentage", p.MemPercentage).
+		Float64("reducedTo", p.MemPercentage*factor).
+		Int("oomKills", oomKills).
+		Msg("Reduced heap percentage after Java was OOM-killed")
+	p.MemPercentage *= factor
+	return p
 }
 
 // Tune returns JVM options based on detected resources and user flags.
-func Tune(javaVersion string, cpuCount int, memLimit uint64, memPercentage float64, otherFlags []string) Options {
+func Tune(p Params) (Options, error) {
 	log.Debug().Msg("Tuning JVM options")
 	opts := Options{}
 
-	defaults := GetDefaults(javaVersion)
-	opts.OtherOpts = append(opts.OtherOpts, defaults.opts...)
+	defaults := GetDefaults(p.JavaVersion)
+	opts.ProfileOpts = append(opts.ProfileOpts, defaults.opts...)
+
+	blacklist := p.Blacklist
+	if blacklist == nil {
+		blacklist = DefaultBlacklist
+	}
+	userFlags, err := ApplyBlacklist(p.OtherFlags, blacklist, p.JavaVersion, p.MemPercentage)
+	if err != nil {
+		return opts, err
+	}
+	userFlags, _, err = MigrateOptions(userFlags, p.JavaVersion)
+	if err != nil {
+		return opts, err
+	}
+	p.OtherFlags = userFlags
+
+	// Memory options
+	if p.MinHeap > 0 && p.MaxHeap > 0 && p.MinHeap > p.MaxHeap {
+		return opts, fmt.Errorf("minimum heap %s is bigger than maximum heap %s", FormatSize(p.MinHeap), FormatSize(p.MaxHeap))
+	}
+	var heap uint64
+	if p.Calculator.Enabled {
+		calculator := p.Calculator.withUserFlags(p.OtherFlags)
+		calculator.Headroom = p.headroom()
+		plan, err := calculator.Calculate(p.MemLimit, p.JavaVersion)
+		if err != nil {
+			return opts, err
+		}
+		log.Info().
+			Str("total", FormatSize(plan.Total)).
+			Str("heap", FormatSize(plan.Heap)).
+			Str("metaspace", FormatSize(plan.Metaspace)).
+			Int("classCount", plan.ClassCount).
+			Str("codeCache", FormatSize(plan.CodeCache)).
+			Str("stacks", FormatSize(plan.Stacks)).
+			Int("threadCount", plan.ThreadCount).
+			Str("directMemory", FormatSize(plan.DirectMemory)).
+			Str("headroom", FormatSize(plan.Headroom)).
+			Msg("Calculated memory regions")
+		plan.Heap = limitHeap(plan.Heap, p)
+		heap = plan.Heap
+		opts.MemoryOpts = append(opts.MemoryOpts, plan.Options()...)
+	} else {
+		var heapOpts []string
+		heapOpts, heap = tuneHeap(p, defaults)
+		opts.MemoryOpts = append(opts.MemoryOpts, heapOpts...)
+	}
+	opts.MemoryOpts, heap = keepUserHeap(p, opts.MemoryOpts, heap)
+
+	// GC options
+	gc, gcOpts := tuneGC(p, heap)
+	opts.GCOpts = append(opts.GCOpts, gcOpts...)
+	if SupportsStringDeduplication(gc, p.JavaVersion) {
+		opts.GCOpts = append(opts.GCOpts, "-XX:+UseStringDeduplication")
+		log.Debug().Str("gc", gc).Msg("Enabling string deduplication")
+	}
+
+	// CPU options
+	opts.CPUOpts = append(opts.CPUOpts, tuneCPU(p, defaults)...)
+	opts.CPUOpts = append(opts.CPUOpts, tuneThreads(p, gc)...)
+
+	// Other options
+	opts.UserOpts = append(opts.UserOpts, p.OtherFlags...)
+	log.Debug().Strs("otherFlags", p.OtherFlags).Msg("Using additional JVM options")
+	return opts, nil
+}
+
+// tuneHeap returns percentage based heap flags and the expected heap size.
+func tuneHeap(p Params, defaults ConfigSet) ([]string, uint64) {
+	opts := []string{}
+	maxRAM, _ := p.maxRAM()
 
-	if semver.Compare(defaults.maxVersion, "v10.0") < 0 { // older Java, calculate limits in MB
+	if !defaults.percentageHeap { // older Java, calculate limits in MB
+		heap := limitHeap(uint64(float64(p.MemLimit)*p.MemPercentage/100), p)
 		for _, flag := range defaults.maxRamFlags {
 			// we take the percentage of max memory limit and convert it to MB
-			opts.MemoryOpts = append(opts.MemoryOpts, fmt.Sprintf(flag, float64(memLimit)*memPercentage/100/1024/1024))
+			opts = append(opts, fmt.Sprintf(flag, float64(heap)/1024/1024))
 			log.Info().Str("flag", flag).Msg("Using max RAM flag")
 		}
+		initial := min(uint64(float64(p.MemLimit)*p.MemPercentage/100), heap)
 		for _, flag := range defaults.initialRamFlags {
-			opts.MemoryOpts = append(opts.MemoryOpts, fmt.Sprintf(flag, float64(memLimit)*memPercentage/100/1024/1024))
+			opts = append(opts, fmt.Sprintf(flag, float64(initial)/1024/1024))
 			log.Info().Str("flag", flag).Msg("Using initial RAM flag")
 		}
-	} else { // Java 10+, use percentage
+		return append(opts, maxRAMOptions(p)...), heap
+	}
+
+	// Java 10+ and 8u191+, use percentage
+	heap := uint64(float64(maxRAM) * p.MemPercentage / 100)
+	if clamped := limitHeap(heap, p); clamped != heap {
+		heap = clamped
+		opts = append(opts, "-Xmx"+FormatSize(heap/MiB*MiB))
+		log.Info().Str("heap", FormatSize(heap)).Msg("Using absolute max heap instead of percentage")
+	} else {
 		for _, flag := range defaults.maxRamFlags {
-			opts.MemoryOpts = append(opts.MemoryOpts, fmt.Sprintf(flag, memPercentage))
+			opts = append(opts, fmt.Sprintf(flag, p.MemPercentage))
 			log.Info().Str("flag", flag).Msg("Using max RAM percentage flag")
 		}
-		for _, flag := range defaults.initialRamFlags {
-			opts.MemoryOpts = append(opts.MemoryOpts, fmt.Sprintf(flag, defaults.initialRamPercentage))
-			log.Info().Str("flag", flag).Msg("Using initial RAM percentage flag")
+	}
+	for _, flag := range defaults.initialRamFlags {
+		opts = append(opts, fmt.Sprintf(flag, defaults.initialRamPercentage))
+		log.Info().Str("flag", flag).Msg("Using initial RAM percentage flag")
+	}
+	return append(opts, maxRAMOptions(p)...), heap
+}
+
+// keepUserHeap drops calculated heap options, when the same heap setting
+// is set in user options, even in a different way, e.g. with
+// -XX:MaxRAMPercentage instead of -Xmx, so they can't supersede the user
+// ones. It returns the heap size expected with user options.
+func keepUserHeap(p Params, opts []string, heap uint64) ([]string, uint64) {
+	user := map[string]Option{}
+	for _, opt := range ParseOptions(p.OtherFlags, OriginUser) {
+		if setting := settingOf(opt); setting == "max heap" || setting == "initial heap" {
+			user[setting] = opt
 		}
 	}
+	if len(user) == 0 {
+		return opts, heap
+	}
 
-	if memLimit < 128*1024*1024 { // Less than 128MB
-		log.Warn().Uint64("memLimit", memLimit).Msg("Memory limit is less than 128MB, setting -XX:MaxRAM would not allow to start JVM, skipping it")
-	} else {
-		maxRAM := memLimit/1024/1024 - 100 // Leave 100MB for OS
-		opts.MemoryOpts = append(opts.MemoryOpts, fmt.Sprintf("-XX:MaxRAM=%dm", maxRAM))
-		log.Debug().Uint64("memLimit", memLimit).Msg("Using memory limit for MaxRAM")
+	kept := []string{}
+	for _, opt := range ParseOptions(opts, OriginDefault) {
+		if winner, ok := user[settingOf(opt)]; ok {
+			log.Debug().Str("option", opt.Raw).Str("winner", winner.Raw).Msg("Dropped calculated heap option set in user options")
+			continue
+		}
+		kept = append(kept, opt.Raw)
 	}
 
-	// CPU options
-	opts.CPUOpts = append(opts.CPUOpts, fmt.Sprintf("-XX:ActiveProcessorCount=%d", cpuCount))
-	log.Debug().Int("cpuCount", cpuCount).Msg("Using CPU count for ActiveProcessorCount")
+	winner, ok := user["max heap"]
+	if !ok {
+		return kept, heap
+	}
+	maxRAM, _ := p.maxRAM()
+	userHeap, ok := heapSizeOf(winner, maxRAM)
+	if !ok {
+		return kept, heap
+	}
+	if p.MinHeap > 0 && userHeap < p.MinHeap || p.MaxHeap > 0 && userHeap > p.MaxHeap {
+		log.Warn().
+			Str("option", winner.Raw).
+			Str("heap", FormatSize(userHeap/MiB*MiB)).
+			Str("minHeap", FormatSize(p.MinHeap)).
+			Str("maxHeap", FormatSize(p.MaxHeap)).
+			Msg("Heap set in user options is out of heap bounds, keeping it")
+	}
+	return kept, userHeap
+}
 
-	// Other options
-	opts.OtherOpts = append(opts.OtherOpts, otherFlags...)
-	log.Debug().Strs("otherFlags", otherFlags).Msg("Using additional JVM options")
-	return opts
+// heapSizeOf returns the max heap size set by the option.
+func heapSizeOf(opt Option, maxRAM uint64) (uint64, bool) {
+	switch opt.Key() {
+	case "-Xmx", "-XX:MaxHeapSize":
+		size, err := ParseSize(opt.Value)
+		return size, err == nil
+	case "-XX:MaxRAMPercentage":
+		percentage, err := strconv.ParseFloat(opt.Value, 64)
+		return uint64(float64(maxRAM) * percentage / 100), err == nil
+	case "-XX:MaxRAMFraction":
+		fraction, err := strconv.ParseUint(opt.Value, 10, 64)
+		if err != nil || fraction == 0 {
+			return 0, false
+		}
+		return maxRAM / fraction, true
+	}
+	return 0, false
+}
+
+// maxRAMOptions limits the memory visible to JVM ergonomics to the memory
+// limit without the headroom.
+func maxRAMOptions(p Params) []string {
+	maxRAM, ok := p.maxRAM()
+	if !ok {
+		log.Warn().Uint64("memLimit", p.MemLimit).Str("headroom", FormatSize(p.headroom())).Msg("Memory limit without headroom is less than 128MB, setting -XX:MaxRAM would not allow to start JVM, skipping it")
+		return []string{}
+	}
+	log.Debug().Uint64("memLimit", p.MemLimit).Str("headroom", FormatSize(p.headroom())).Msg("Using memory limit for MaxRAM")
+	return []string{fmt.Sprintf("-XX:MaxRAM=%dm", maxRAM/MiB)}
+}
+
+// limitHeap applies user bounds and compressed oops cap to the heap size.
+func limitHeap(heap uint64, p Params) uint64 {
+	return capCompressedOops(clampHeap(heap, p), p)
+}
+
+// clampHeap keeps heap size within the bounds requested by the user.
+func clampHeap(heap uint64, p Params) uint64 {
+	switch {
+	case p.MinHeap > 0 && heap < p.MinHeap:
+		log.Info().Str("heap", FormatSize(heap/MiB*MiB)).Str("minHeap", FormatSize(p.MinHeap)).Msg("Heap below the minimum, clamping it")
+		heap = p.MinHeap
+		if heap+p.headroom() > p.MemLimit {
+			log.Warn().Str("heap", FormatSize(heap)).Str("memLimit", FormatSize(p.MemLimit)).Msg("Minimum heap doesn't leave headroom within the memory limit, JVM might be OOM killed")
+		}
+	case p.MaxHeap > 0 && heap > p.MaxHeap:
+		log.Info().Str("heap", FormatSize(heap/MiB*MiB)).Str("maxHeap", FormatSize(p.MaxHeap)).Msg("Heap above the maximum, clamping it")
+		heap = p.MaxHeap
+	}
+	return heap
+}
+
+// maxRAM returns the memory limit without headroom, unless it would leave
+// JVM with less than 128MB.
+func (p Params) maxRAM() (uint64, bool) {
+	if p.MemLimit < p.headroom()+128*MiB {
+		return p.MemLimit, false
+	}
+	return p.MemLimit - p.headroom(), true
+}
+
+// headroom returns memory left for the OS and other processes.
+func (p Params) headroom() uint64 {
+	if p.Headroom == 0 {
+		return DefaultHeadroom
+	}
+	return p.Headroom
 }
 
 // FormatOptions returns a slice of JVM arguments.
 func FormatOptions(opts Options) []string {
 	args := []string{}
-	args = append(args, opts.OtherOpts...)
-	args = append(args, opts.CPUOpts...)
-	args = append(args, opts.MemoryOpts...)
+	for _, opt := range opts.Merge() {
+		log.Debug().Str("option", opt.Raw).Str("origin", opt.Origin).Msg("Using JVM option")
+		args = append(args, opt.String())
+	}
 	return args
 }
+
+// FinalOptions turns tuned options into the ones Java is started with. It
+// points crash files into postMortemDir, when set, applies the rules and
+// validates options with validate, when set, telling it which ones were
+// passed by the user. Options matching the remove patterns are removed last,
+// so also the ones added by previous steps can be removed. It returns kept
+// and removed options.
+func FinalOptions(opts Options, javaVersion, postMortemDir string, validate func(args, userArgs []string) ([]string, error), remove []string) ([]string, []string, error) {
+	args := FormatOptions(opts)
+	if postMortemDir != "" {
+		args = PostMortemOptions(args, postMortemDir)
+	}
+	args = ApplyRules(args, javaVersion)
+	if validate != nil {
+		var err error
+		if args, err = validate(args, opts.UserOpts); err != nil {
+			return nil, nil, err
+		}
+	}
+	kept, removed := RemoveOptions(args, remove)
+	return kept, removed, nil
+}
+
+// Merge returns the final list of options. User options win with the
+// profile ones, which win with the calculated ones.
+func (o Options) Merge() []Option {
+	return MergeOptions(
+		ParseOptions(o.ProfileOpts, OriginProfile),
+		ParseOptions(o.UserOpts, OriginUser),
+		ParseOptions(o.GCOpts, OriginDefault),
+		ParseOptions(o.CPUOpts, OriginDefault),
+		ParseOptions(o.MemoryOpts, OriginDefault),
+	)
+}
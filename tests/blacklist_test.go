@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestApplyBlacklist_Defaults(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		opts        []string
+		want        []string
+	}{
+		{"Java8u102", "1.8.0+102", []string{"-XX:MaxRAMFraction=1", "-XX:MaxRAMFraction=2", "-XX:+UseCGroupMemoryLimitForHeap", "-Xss1m"}, []string{"-XX:MaxRAMFraction=2", "-Xss1m"}},
+		{"Java8u191", "1.8.0+191", []string{"-XX:MaxRAMFraction=2", "-XX:+UseCGroupMemoryLimitForHeap"}, []string{"-XX:MaxRAMPercentage=50.0", "-XX:MaxRAMPercentage=70.0"}},
+		{"Java17", "17.0.16", []string{"-XX:MaxRAMFraction=1", "-Xss1m"}, []string{"-XX:MaxRAMPercentage=100.0", "-Xss1m"}},
+		{"Java21Fraction4", "21.0.2", []string{"-XX:MaxRAMFraction=4"}, []string{"-XX:MaxRAMPercentage=25.0"}},
+		{"Java21Fraction3", "21.0.2", []string{"-XX:MaxRAMFraction=3"}, []string{"-XX:MaxRAMPercentage=33.3"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tuner.ApplyBlacklist(tc.opts, tuner.DefaultBlacklist, tc.javaVersion, 70.0)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, opts)
+		})
+	}
+}
+
+func TestApplyBlacklist_Custom(t *testing.T) {
+	rules := []tuner.BlacklistRule{
+		{Regex: `-XX:PermSize=(.+)`, Severity: tuner.SeverityStrip, Replacement: "-XX:MetaspaceSize=$1"},
+		{Pattern: "-agentlib:jdwp=*", Severity: tuner.SeverityFail, Reason: "remote debugging"},
+		{Pattern: "-XX:+UseConcMarkSweepGC", Severity: tuner.SeverityWarn, MinVersion: "v9"},
+	}
+
+	opts, err := tuner.ApplyBlacklist([]string{"-XX:PermSize=64m", "-XX:+UseConcMarkSweepGC"}, rules, "11.0.28", 70.0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-XX:MetaspaceSize=64m", "-XX:+UseConcMarkSweepGC"}, opts)
+
+	_, err = tuner.ApplyBlacklist([]string{"-agentlib:jdwp=transport=dt_socket,server=y"}, rules, "11.0.28", 70.0)
+	assert.ErrorContains(t, err, "remote debugging")
+}
+
+func TestApplyBlacklist_Override(t *testing.T) {
+	rules := append([]tuner.BlacklistRule{
+		{Pattern: "-XX:MaxRAMFraction=*", MinVersion: "v9", Severity: tuner.SeverityFail, Reason: "use MaxRAMPercentage"},
+	}, tuner.DefaultBlacklist...)
+
+	_, err := tuner.ApplyBlacklist([]string{"-XX:MaxRAMFraction=2"}, rules, "21.0.2", 70.0)
+	assert.ErrorContains(t, err, "use MaxRAMPercentage")
+
+	opts, err := tuner.ApplyBlacklist([]string{"-XX:MaxRAMFraction=2"}, rules, "1.8.0+191", 70.0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-XX:MaxRAMPercentage=50.0"}, opts)
+}
+
+func TestLoadBlacklist(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+blacklist:
+  - regex: -XX:MaxPermSize=.*
+    severity: strip
+    max-version: v1.8
+    reason: PermGen is gone
+  - pattern: -agentlib:jdwp=*
+    severity: fail
+`), 0o644))
+
+	rules, err := tuner.LoadBlacklist(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []tuner.BlacklistRule{
+		{Regex: "-XX:MaxPermSize=.*", Severity: tuner.SeverityStrip, MaxVersion: "v1.8", Reason: "PermGen is gone"},
+		{Pattern: "-agentlib:jdwp=*", Severity: tuner.SeverityFail},
+	}, rules)
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	assert.NoError(t, os.WriteFile(invalid, []byte("blacklist:\n  - pattern: -Xss1m\n    severity: drop\n"), 0o644))
+	_, err = tuner.LoadBlacklist(invalid)
+	assert.ErrorContains(t, err, "unknown severity")
+
+	_, err = tuner.LoadBlacklist(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestTune_Blacklist(t *testing.T) {
+	opts, err := tuner.Tune(tuner.Params{
+		JavaVersion:   "v17.0.16",
+		CPUCount:      2,
+		MemLimit:      2 * tuner.GiB,
+		MemPercentage: 70.0,
+		OtherFlags:    []string{"-XX:MaxRAMFraction=2"},
+	})
+	assert.NoError(t, err)
+	args := tuner.FormatOptions(opts)
+	assert.NotContains(t, args, "-XX:MaxRAMFraction=2")
+	assert.Contains(t, args, "-XX:MaxRAMPercentage=50.0")
+
+	_, err = tuner.Tune(tuner.Params{
+		JavaVersion:   "v17.0.16",
+		CPUCount:      2,
+		MemLimit:      2 * tuner.GiB,
+		MemPercentage: 70.0,
+		OtherFlags:    []string{"-Xdebug"},
+		Blacklist:     append(slices.Clone(tuner.DefaultBlacklist), tuner.BlacklistRule{Pattern: "-Xdebug", Severity: tuner.SeverityFail}),
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestMemoryCalculator(t *testing.T) {
+	cases := []struct {
+		name        string
+		total       uint64
+		calculator  tuner.MemoryCalculator
+		javaVersion string
+		wantHeap    uint64
+		wantOpts    []string
+	}{
+		{
+			name:        "Defaults1G",
+			total:       1 * tuner.GiB,
+			calculator:  tuner.MemoryCalculator{ClassCount: 10000},
+			javaVersion: "v17.0.16",
+			// 1024 - 69 (metaspace) - 240 (code cache) - 250 (stacks) - 10 (direct) - 100 (headroom)
+			wantHeap: 355 * tuner.MiB,
+			wantOpts: []string{"-Xmx355m", "-Xss1m", "-XX:MaxMetaspaceSize=69m", "-XX:ReservedCodeCacheSize=240m", "-XX:MaxDirectMemorySize=10m"},
+		},
+		{
+			name:  "ManyThreadsSmallStacks",
+			total: 2 * tuner.GiB,
+			calculator: tuner.MemoryCalculator{
+				ClassCount:   10000,
+				ThreadCount:  500,
+				StackSize:    512 * tuner.KiB,
+				DirectMemory: 256 * tuner.MiB,
+			},
+			javaVersion: "v21.0.8",
+			// 2048 - 69 - 240 - 250 - 256 - 100
+			wantHeap: 1133 * tuner.MiB,
+			wantOpts: []string{"-Xmx1133m", "-Xss512k", "-XX:MaxDirectMemorySize=256m"},
+		},
+		{
+			name:        "Java7CodeCache",
+			total:       1 * tuner.GiB,
+			calculator:  tuner.MemoryCalculator{ClassCount: 10000},
+			javaVersion: "v1.7.0",
+			wantHeap:    547 * tuner.MiB,
+			wantOpts:    []string{"-XX:ReservedCodeCacheSize=48m"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := tc.calculator.Calculate(tc.total, tc.javaVersion)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantHeap, plan.Heap)
+			for _, opt := range tc.wantOpts {
+				assert.Contains(t, plan.Options(), opt)
+			}
+		})
+	}
+}
+
+func TestMemoryCalculator_TooLow(t *testing.T) {
+	_, err := tuner.MemoryCalculator{ClassCount: 10000}.Calculate(512*tuner.MiB, "v17.0.16")
+	assert.ErrorContains(t, err, "memory limit 512m is too low")
+}
+
+func TestTune_MemoryCalculator(t *testing.T) {
+	opts, err := tuner.Tune(tuner.Params{
+		JavaVersion:   "v17.0.16",
+		CPUCount:      2,
+		MemLimit:      1 * tuner.GiB,
+		MemPercentage: 70.0,
+		Calculator:    tuner.MemoryCalculator{Enabled: true, ClassCount: 10000},
+		OtherFlags:    []string{"-Xss256k"},
+	})
+	assert.NoError(t, err)
+	// 1024 - 69 - 240 - 62.5 (stacks) - 10 - 100
+	assert.Contains(t, opts.MemoryOpts, "-Xmx542m")
+	assert.Contains(t, opts.MemoryOpts, "-Xss256k")
+	for _, opt := range opts.MemoryOpts {
+		assert.NotContains(t, opt, "MaxRAMPercentage")
+	}
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+// zipBytes builds a zip archive with given files.
+func zipBytes(t *testing.T, files map[string][]byte) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for name, content := range files {
+		f, err := w.Create(name)
+		assert.NoError(t, err)
+		_, err = f.Write(content)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func writeJar(t *testing.T, path string, files map[string][]byte) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.NoError(t, os.WriteFile(path, zipBytes(t, files), 0o644))
+}
+
+func TestClasspathFromArgs(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"Jar", []string{"-jar", "app.jar", "--server.port=8080"}, []string{"app.jar"}},
+		{"ShortClasspath", []string{"-cp", "lib/*:app.jar", "com.example.Main"}, []string{"lib/*", "app.jar"}},
+		{"LongClasspath", []string{"--add-opens", "java.base/java.lang=ALL-UNNAMED", "--class-path=classes", "Main"}, []string{"classes"}},
+		{"AfterMainClass", []string{"com.example.Main", "-cp", "ignored.jar"}, []string{}},
+	}
+	t.Setenv("CLASSPATH", "")
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tc.want, tuner.ClasspathFromArgs(tc.args))
+		})
+	}
+}
+
+func TestScanClasspath(t *testing.T) {
+	dir := t.TempDir()
+
+	// Spring Boot fat jar with nested dependencies
+	writeJar(t, filepath.Join(dir, "boot.jar"), map[string][]byte{
+		"BOOT-INF/classes/com/example/App.class": {},
+		"BOOT-INF/classes/application.yaml":      {},
+		"BOOT-INF/lib/dep.jar": zipBytes(t, map[string][]byte{
+			"org/dep/A.class": {},
+			"org/dep/B.class": {},
+		}),
+	})
+	// plain jars, expanded with wildcard
+	writeJar(t, filepath.Join(dir, "lib", "a.jar"), map[string][]byte{
+		"a/A.class":         {},
+		"module-info.class": {},
+	})
+	writeJar(t, filepath.Join(dir, "lib", "b.jar"), map[string][]byte{
+		"b/B.class": {},
+		"b/C.class": {},
+	})
+	// classes directory
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "classes", "pkg"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "classes", "pkg", "Main.class"), []byte{}, 0o644))
+
+	// fake JDK with 48000 bytes of modules, 10 classes
+	javaHome := filepath.Join(dir, "jdk")
+	assert.NoError(t, os.MkdirAll(filepath.Join(javaHome, "lib"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(javaHome, "lib", "modules"), make([]byte, 48000), 0o644))
+
+	scan := tuner.ScanClasspath([]string{
+		filepath.Join(dir, "boot.jar"),
+		filepath.Join(dir, "lib", "*"),
+		filepath.Join(dir, "classes"),
+	}, javaHome)
+
+	assert.Len(t, scan.Entries, 4)
+	assert.Equal(t, 7, scan.AppClasses)
+	assert.Equal(t, 10, scan.JDKClasses)
+	assert.Equal(t, 5, scan.Loaded) // 35% of 17
+}
+
+func TestDetectResources_ClassScan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake Java is a shell script")
+	}
+	dir := t.TempDir()
+	javaHome := filepath.Join(dir, "jdk")
+	assert.NoError(t, os.MkdirAll(filepath.Join(javaHome, "bin"), 0o755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(javaHome, "lib"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(javaHome, "lib", "modules"), make([]byte, 48000), 0o644))
+	java := filepath.Join(javaHome, "bin", "java")
+	assert.NoError(t, os.WriteFile(java, []byte("#!/bin/sh\necho 'openjdk version \"17.0.2\" 2022-01-18' >&2\n"), 0o755))
+	writeJar(t, filepath.Join(dir, "app.jar"), map[string][]byte{
+		"a/A.class": {},
+		"a/B.class": {},
+	})
+
+	params := tuner.Params{
+		JavaBin:       java,
+		CPUCount:      2,
+		MemLimit:      1 * tuner.GiB,
+		MemPercentage: 70.0,
+		Calculator:    tuner.MemoryCalculator{Enabled: true},
+		ScanClasspath: true,
+		Args:          []string{"-jar", filepath.Join(dir, "app.jar")},
+	}
+	detected, err := tuner.DetectResources(params)
+	assert.NoError(t, err)
+	if assert.NotNil(t, detected.ClassScan) {
+		assert.Equal(t, []string{filepath.Join(dir, "app.jar")}, detected.ClassScan.Entries)
+		assert.Equal(t, 2, detected.ClassScan.AppClasses)
+		assert.Equal(t, 10, detected.ClassScan.JDKClasses)
+		assert.Equal(t, detected.ClassScan.Loaded, detected.Calculator.ClassCount)
+	}
+
+	params.ScanClasspath = false
+	detected, err = tuner.DetectResources(params)
+	assert.NoError(t, err)
+	assert.Nil(t, detected.ClassScan)
+}
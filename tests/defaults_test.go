@@ -49,3 +49,107 @@ func TestJavaVersion_NotFound(t *testing.T) {
 	assert.Error(t, err)
 	assert.Empty(t, version)
 }
+
+func TestRAMPercentage_Curve(t *testing.T) {
+	cases := []struct {
+		name           string
+		memLimit       uint64
+		wantPercentage float64
+		wantBreakpoint string
+	}{
+		{"256Mi", 256 * tuner.MiB, 50.0, "<=512m"},
+		{"512Mi", 512 * tuner.MiB, 50.0, "<=512m"},
+		{"1Gi", 1 * tuner.GiB, 65.0, "<=2g"},
+		{"8Gi", 8 * tuner.GiB, 75.0, "<=8g"},
+		{"32Gi", 32 * tuner.GiB, 85.0, "any"},
+	}
+
+	for _, javaVersion := range []string{"v1.8.0", "v17.0.16"} {
+		defaults := tuner.GetDefaults(javaVersion)
+		for _, tc := range cases {
+			t.Run(javaVersion+"/"+tc.name, func(t *testing.T) {
+				percentage, breakpoint := defaults.RAMPercentage(tc.memLimit)
+				assert.Equal(t, tc.wantPercentage, percentage)
+				assert.Equal(t, tc.wantBreakpoint, breakpoint)
+			})
+		}
+	}
+}
+
+func TestMatchDefaults(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		wantRange   string
+		wantErr     bool
+	}{
+		{"Java8u462", "1.8.0+462", "[v1.8.191, v1.9)", false},
+		{"Java8u191", "1.8.0+191", "[v1.8.191, v1.9)", false},
+		{"Java8u190", "1.8.0+190", "[v1.7, v1.8.191)", false},
+		{"Java8u131", "1.8.0+131", "[v1.7, v1.8.191)", false},
+		{"Java8u102", "1.8.0+102", "[v1.7, v1.8.191)", false},
+		{"Java21", "21.0.8", "[v10, v26)", false},
+		{"Java26", "26", "[v10, v26)", true},
+		{"Java6", "1.6.0+45", "[v1.7, v1.8.191)", true},
+		{"Unparsable", "not-a-version", "[v10, v26)", true},
+		{"Empty", "", "[v10, v26)", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			defaults, err := tuner.MatchDefaults(tc.javaVersion)
+			assert.Equal(t, tc.wantRange, defaults.Range())
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantRange, tuner.GetDefaults(tc.javaVersion).Range())
+		})
+	}
+}
+
+func TestTune_FutureVersion(t *testing.T) {
+	opts, err := tuner.Tune(tuner.Params{
+		JavaVersion:   "27.0.1",
+		CPUCount:      2,
+		MemLimit:      1 * tuner.GiB,
+		MemPercentage: 70.0,
+	})
+	assert.NoError(t, err)
+	args := tuner.FormatOptions(opts)
+	assert.Contains(t, args, "-XX:MaxRAMPercentage=70.0")
+	assert.Contains(t, args, "-XX:ActiveProcessorCount=2")
+}
+
+func TestTune_VendorVersion(t *testing.T) {
+	cases := []struct {
+		name      string
+		cpu       int
+		mem       uint64
+		wantFlags []string
+		notFlags  []string
+	}{
+		{"G1", 4, 8 * tuner.GiB, []string{"-XX:+UseG1GC"}, []string{"-XX:+UseParallelGC"}},
+		{"CICompilerCount", 2, 1 * tuner.GiB, []string{"-XX:CICompilerCount=2"}, []string{"-XX:CICompilerCount=1"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   "11.0.22.1",
+				CPUCount:      tc.cpu,
+				MemLimit:      tc.mem,
+				MemPercentage: 75.0,
+			})
+			assert.NoError(t, err)
+			args := tuner.FormatOptions(opts)
+			for _, flag := range tc.wantFlags {
+				assert.Contains(t, args, flag)
+			}
+			for _, flag := range tc.notFlags {
+				assert.NotContains(t, args, flag)
+			}
+		})
+	}
+}
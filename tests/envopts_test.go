@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestReadEnvOptions(t *testing.T) {
+	env := map[string]string{
+		"JAVA_TOOL_OPTIONS": "-Xmx1g -Dfoo=bar",
+		"JDK_JAVA_OPTIONS":  "  ",
+		"APP_OPTS":          "-Xss2m",
+	}
+	opts := tuner.ReadEnvOptions(func(name string) string { return env[name] }, "APP_OPTS")
+	assert.Len(t, opts, 2)
+	assert.Equal(t, "JAVA_TOOL_OPTIONS", opts[0].Name)
+	assert.True(t, opts[0].ReadByJVM)
+	assert.Len(t, opts[0].Options, 2)
+	assert.Equal(t, tuner.OriginEnv, opts[0].Options[0].Origin)
+	assert.Equal(t, "APP_OPTS", opts[1].Name)
+	assert.False(t, opts[1].ReadByJVM)
+}
+
+func TestResolveEnvOptions(t *testing.T) {
+	args := []string{"-XX:+UseG1GC", "-XX:MaxRAMPercentage=70.0", "-Xss1m"}
+	env := []tuner.EnvOptions{
+		{
+			Name:      "JAVA_TOOL_OPTIONS",
+			Options:   tuner.ParseOptions([]string{"-Xmx1g", "-Dfoo=bar"}, tuner.OriginEnv),
+			ReadByJVM: true,
+		},
+		{
+			Name:    "JAVA_OPTS",
+			Options: tuner.ParseOptions([]string{"-XX:+UseParallelGC", "-Xss1m", "-Dapp=1"}, tuner.OriginEnv),
+		},
+	}
+
+	cases := []struct {
+		policy   string
+		wantArgs []string
+		wantEnv  map[string]string
+		wantErr  bool
+	}{
+		{
+			policy:   tuner.EnvOptsHonour,
+			wantArgs: []string{"-Xss1m", "-XX:+UseParallelGC", "-Dapp=1"},
+			wantEnv:  map[string]string{},
+		},
+		{
+			policy:   tuner.EnvOptsOverride,
+			wantArgs: []string{"-XX:+UseG1GC", "-XX:MaxRAMPercentage=70.0", "-Xss1m", "-Dapp=1"},
+			wantEnv:  map[string]string{"JAVA_TOOL_OPTIONS": "-Dfoo=bar"},
+		},
+		{
+			policy:  tuner.EnvOptsFail,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			res, err := tuner.ResolveEnvOptions(args, env, tc.policy)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantArgs, res.Args)
+			assert.Equal(t, tc.wantEnv, res.Env)
+		})
+	}
+}
+
+func TestResolveEnvOptions_Quoting(t *testing.T) {
+	value := `-Dfoo="a b" -Dmsg='it'"'"'s' -Xmx1g`
+	env := tuner.ReadEnvOptions(func(name string) string {
+		if name == "JAVA_TOOL_OPTIONS" {
+			return value
+		}
+		return ""
+	}, "")
+	res, err := tuner.ResolveEnvOptions([]string{"-Xmx2g"}, env, tuner.EnvOptsOverride)
+	assert.NoError(t, err)
+	assert.Equal(t, `'-Dfoo=a b' '-Dmsg=it'"'"'s'`, res.Env["JAVA_TOOL_OPTIONS"])
+
+	words, err := tuner.SplitOpts(res.Env["JAVA_TOOL_OPTIONS"])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-Dfoo=a b", "-Dmsg=it's"}, words)
+}
+
+func TestEnvResolution_ApplyEnv(t *testing.T) {
+	res := tuner.EnvResolution{Env: map[string]string{"JAVA_TOOL_OPTIONS": "", "JDK_JAVA_OPTIONS": "-Dfoo=bar"}}
+	environ := res.ApplyEnv([]string{"PATH=/bin", "JAVA_TOOL_OPTIONS=-Xmx1g", "JDK_JAVA_OPTIONS=-Xmx1g -Dfoo=bar"})
+	assert.Equal(t, []string{"PATH=/bin", "JDK_JAVA_OPTIONS=-Dfoo=bar"}, environ)
+}
+
+func TestEffectiveOptions(t *testing.T) {
+	environ := []string{
+		"_JAVA_OPTIONS=-Xmx2g",
+		"PATH=/usr/bin",
+		"JAVA_TOOL_OPTIONS=-agentlib:jdwp=transport=dt_socket -Dfoo=bar",
+		"JDK_JAVA_OPTIONS=-Xss1m",
+		"JAVA_OPTS=-Xms1g",
+	}
+	assert.Equal(t,
+		[]string{"-agentlib:jdwp=transport=dt_socket", "-Dfoo=bar", "-Xss1m", "-Xmx1g", "-XX:+UseG1GC", "-Xmx2g"},
+		tuner.EffectiveOptions([]string{"-Xmx1g", "-XX:+UseG1GC"}, environ),
+	)
+	assert.Equal(t, []string{"-Xmx1g"}, tuner.EffectiveOptions([]string{"-Xmx1g"}, []string{"PATH=/usr/bin"}))
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+const gb = 1024 * 1024 * 1024
+
+func TestSelectGC(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		vendor      string
+		cpu         int
+		mem         uint64
+		heap        uint64
+		want        string
+	}{
+		{"SingleCPU", "v17.0.16", tuner.VendorCorretto, 1, 10 * gb, 8 * gb, tuner.GCSerial},
+		{"SmallMachine", "v17.0.16", tuner.VendorCorretto, 4, 1 * gb, 1 * gb / 2, tuner.GCSerial},
+		{"SmallHeapServerMachine", "v17.0.16", tuner.VendorCorretto, 4, 2 * gb, 1 * gb, tuner.GCG1},
+		{"UnknownMemory", "v17.0.16", tuner.VendorCorretto, 4, 0, 1 * gb, tuner.GCG1},
+		{"MediumHeap", "v17.0.16", tuner.VendorCorretto, 4, 4 * gb, 3 * gb, tuner.GCG1},
+		{"Java7", "v1.7.0", tuner.VendorOracle, 4, 10 * gb, 8 * gb, tuner.GCParallel},
+		{"Java8", "1.8.0+462", tuner.VendorCorretto, 4, 10 * gb, 8 * gb, tuner.GCG1},
+		{"BigHeapJava21", "21.0.8", tuner.VendorTemurin, 8, 40 * gb, 32 * gb, tuner.GCZ},
+		{"BigHeapJava17", "17.0.16", tuner.VendorTemurin, 8, 40 * gb, 32 * gb, tuner.GCShenandoah},
+		{"BigHeapJava17Oracle", "17.0.16", tuner.VendorOracle, 8, 40 * gb, 32 * gb, tuner.GCG1},
+		{"BigHeapJava11", "11.0.28", tuner.VendorCorretto, 8, 40 * gb, 32 * gb, tuner.GCG1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tuner.SelectGC(tc.javaVersion, tc.vendor, tc.cpu, tc.mem, tc.heap))
+		})
+	}
+}
+
+func TestTune_GC(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		gc          string
+		cpu         int
+		mem         uint64
+		extra       []string
+		wantFlags   []string
+		notFlags    []string
+	}{
+		{
+			name:        "AutoSerialNoDedup",
+			javaVersion: "v17.0.16",
+			cpu:         1,
+			mem:         1 * gb,
+			wantFlags:   []string{"-XX:+UseSerialGC"},
+			notFlags:    []string{"-XX:+UseStringDeduplication"},
+		},
+		{
+			name:        "AutoSerialDedupJava21",
+			javaVersion: "v21.0.8",
+			cpu:         1,
+			mem:         1 * gb,
+			wantFlags:   []string{"-XX:+UseSerialGC", "-XX:+UseStringDeduplication"},
+		},
+		{
+			name:        "AutoG1ServerMachine",
+			javaVersion: "v17.0.16",
+			cpu:         4,
+			mem:         2 * gb,
+			wantFlags:   []string{"-XX:+UseG1GC"},
+			notFlags:    []string{"-XX:+UseSerialGC", "-XX:+UseParallelGC"},
+		},
+		{
+			name:        "RequestedParallel",
+			javaVersion: "v17.0.16",
+			gc:          tuner.GCParallel,
+			cpu:         4,
+			mem:         2 * gb,
+			wantFlags:   []string{"-XX:+UseParallelGC"},
+			notFlags:    []string{"-XX:+UseG1GC"},
+		},
+		{
+			name:        "AutoG1Dedup",
+			javaVersion: "v17.0.16",
+			cpu:         4,
+			mem:         8 * gb,
+			wantFlags:   []string{"-XX:+UseG1GC", "-XX:+UseStringDeduplication"},
+		},
+		{
+			name:        "GenerationalZGC",
+			javaVersion: "v21.0.8",
+			gc:          tuner.GCZ,
+			cpu:         4,
+			mem:         8 * gb,
+			wantFlags:   []string{"-XX:+UseZGC", "-XX:+ZGenerational"},
+		},
+		{
+			name:        "UnsupportedOverride",
+			javaVersion: "v1.8.0",
+			gc:          tuner.GCZ,
+			cpu:         1,
+			mem:         1 * gb,
+			wantFlags:   []string{"-XX:+UseSerialGC"},
+			notFlags:    []string{"-XX:+UseZGC"},
+		},
+		{
+			name:        "UserFlagWins",
+			javaVersion: "v17.0.16",
+			gc:          tuner.GCG1,
+			cpu:         4,
+			mem:         8 * gb,
+			extra:       []string{"-XX:+UseParallelGC"},
+			wantFlags:   []string{"-XX:+UseParallelGC"},
+			notFlags:    []string{"-XX:+UseG1GC", "-XX:+UseStringDeduplication"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   tc.javaVersion,
+				Vendor:        tuner.VendorTemurin,
+				CPUCount:      tc.cpu,
+				MemLimit:      tc.mem,
+				MemPercentage: 70.0,
+				GC:            tc.gc,
+				OtherFlags:    tc.extra,
+			})
+			assert.NoError(t, err)
+			args := tuner.FormatOptions(opts)
+			for _, flag := range tc.wantFlags {
+				assert.Contains(t, args, flag)
+			}
+			for _, flag := range tc.notFlags {
+				assert.NotContains(t, args, flag)
+			}
+		})
+	}
+}
+
+func TestGCOptions_Shenandoah(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		vendor      string
+		want        []string
+	}{
+		{"RedHatJava8", "1.8.0+462", tuner.VendorRedHat, []string{"-XX:+UseShenandoahGC"}},
+		{"Java11Backport", "11.0.28", tuner.VendorTemurin, []string{"-XX:+UseShenandoahGC"}},
+		{"ExperimentalJava13", "13.0.2", tuner.VendorTemurin, []string{"-XX:+UnlockExperimentalVMOptions", "-XX:+UseShenandoahGC"}},
+		{"Java17", "17.0.16", tuner.VendorTemurin, []string{"-XX:+UseShenandoahGC"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tuner.GCOptions(tuner.GCShenandoah, tc.javaVersion, tc.vendor))
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+const printFlagsFinal17 = `[Global flags]
+     bool AlwaysActAsServerClassMachine            = false                                     {product} {default}
+      int ActiveProcessorCount                     = -1                                        {product} {default}
+   size_t MaxRAM                                   = 137438953472                           {pd product} {default}
+   double MaxRAMPercentage                         = 25.000000                                 {product} {default}
+     bool UnlockDiagnosticVMOptions                = true                                   {diagnostic} {command line}
+     bool UnlockExperimentalVMOptions              = true                                   {experimental} {command line}
+     bool UseG1GC                                  = true                                      {product} {ergonomic}
+     bool UseStringDeduplication                   = false                                     {product} {default}
+     bool UseZGC                                   = false                                     {product} {default}
+     bool PrintCompilation2                        = false                                  {diagnostic} {default}
+    ccstr ErrorFile                                =                                           {product} {default}
+openjdk version "17.0.16" 2025-07-15 LTS`
+
+const printFlagsFinal8 = `[Global flags]
+     bool AlwaysActAsServerClassMachine             = false                               {product}
+    uintx MaxRAM                                    = 137438953472                        {pd product}
+     bool UnlockExperimentalVMOptions              := true                                {experimental}
+     bool UseCGroupMemoryLimitForHeap               = false                               {experimental}
+openjdk version "1.8.0_462"`
+
+func TestParsePrintFlagsFinal(t *testing.T) {
+	flags := tuner.ParsePrintFlagsFinal(printFlagsFinal17)
+	assert.Len(t, flags, 11)
+	assert.Equal(t, tuner.JVMFlag{
+		Name: "MaxRAM", Type: "size_t", Value: "137438953472", Kind: tuner.FlagProduct, Origin: "default",
+	}, flags["MaxRAM"])
+	assert.Equal(t, "ergonomic", flags["UseG1GC"].Origin)
+	assert.Equal(t, tuner.FlagDiagnostic, flags["PrintCompilation2"].Kind)
+	assert.Equal(t, "", flags["ErrorFile"].Value)
+
+	flags = tuner.ParsePrintFlagsFinal(printFlagsFinal8)
+	assert.Len(t, flags, 4)
+	assert.Equal(t, tuner.FlagExperimental, flags["UseCGroupMemoryLimitForHeap"].Kind)
+	assert.Equal(t, "default", flags["UseCGroupMemoryLimitForHeap"].Origin)
+	assert.Equal(t, "command line", flags["UnlockExperimentalVMOptions"].Origin)
+}
+
+func TestValidateOptions(t *testing.T) {
+	flags := tuner.ParsePrintFlagsFinal(printFlagsFinal17)
+	cases := []struct {
+		name      string
+		opts      []string
+		onInvalid string
+		generated bool // options not passed by the user
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "Valid",
+			opts:      []string{"-XX:+UseG1GC", "-XX:MaxRAMPercentage=70.0", "-Xss1m", "-Dfoo=bar"},
+			onInvalid: tuner.OnInvalidDrop,
+			want:      []string{"-XX:+UseG1GC", "-XX:MaxRAMPercentage=70.0", "-Xss1m", "-Dfoo=bar"},
+		},
+		{
+			name:      "DropUnknown",
+			opts:      []string{"-XX:+UseG1GCC", "-XX:+UseG1GC"},
+			onInvalid: tuner.OnInvalidDrop,
+			want:      []string{"-XX:+UseG1GC"},
+		},
+		{
+			name:      "KeepNonXX",
+			opts:      []string{"-Xbootclasspath/a:/opt/x.jar", "-Xmx=512m", "-XX:+UseG1GC"},
+			onInvalid: tuner.OnInvalidFail,
+			want:      []string{"-Xbootclasspath/a:/opt/x.jar", "-Xmx=512m", "-XX:+UseG1GC"},
+		},
+		{
+			name:      "DropWrongType",
+			opts:      []string{"-XX:+MaxRAM", "-XX:UseZGC=true", "-XX:MaxRAM=1g"},
+			onInvalid: tuner.OnInvalidDrop,
+			want:      []string{"-XX:MaxRAM=1g"},
+		},
+		{
+			name:      "WarnKeeps",
+			opts:      []string{"-XX:+UseG1GCC", "-XX:+UseG1GC"},
+			onInvalid: tuner.OnInvalidWarn,
+			want:      []string{"-XX:+UseG1GCC", "-XX:+UseG1GC"},
+		},
+		{
+			name:      "Fail",
+			opts:      []string{"-XX:+UseG1GCC"},
+			onInvalid: tuner.OnInvalidFail,
+			wantErr:   true,
+		},
+		{
+			name:      "GeneratedDropped",
+			opts:      []string{"-XX:+UseG1GCC", "-XX:+UseG1GC"},
+			onInvalid: tuner.OnInvalidWarn,
+			generated: true,
+			want:      []string{"-XX:+UseG1GC"},
+		},
+		{
+			name:      "GeneratedDroppedOnFail",
+			opts:      []string{"-XX:+UseG1GCC"},
+			onInvalid: tuner.OnInvalidFail,
+			generated: true,
+			want:      []string{},
+		},
+		{
+			name:      "UnlockDiagnostic",
+			opts:      []string{"-XX:+UseG1GC", "-XX:+PrintCompilation2", "-XX:-PrintCompilation2"},
+			onInvalid: tuner.OnInvalidDrop,
+			want:      []string{"-XX:+UseG1GC", "-XX:+UnlockDiagnosticVMOptions", "-XX:+PrintCompilation2", "-XX:-PrintCompilation2"},
+		},
+		{
+			name:      "AlreadyUnlocked",
+			opts:      []string{"-XX:+UnlockDiagnosticVMOptions", "-XX:+PrintCompilation2"},
+			onInvalid: tuner.OnInvalidDrop,
+			want:      []string{"-XX:+UnlockDiagnosticVMOptions", "-XX:+PrintCompilation2"},
+		},
+		{
+			name:      "UnlockedLater",
+			opts:      []string{"-XX:+PrintCompilation2", "-XX:+UseG1GC", "-XX:+UnlockDiagnosticVMOptions"},
+			onInvalid: tuner.OnInvalidDrop,
+			want:      []string{"-XX:+UnlockDiagnosticVMOptions", "-XX:+PrintCompilation2", "-XX:+UseG1GC"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			userOpts := tc.opts
+			if tc.generated {
+				userOpts = nil
+			}
+			opts, err := tuner.ValidateOptions(tc.opts, userOpts, flags, tc.onInvalid)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, opts)
+		})
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	opts := []string{"-XX:+UseG1GC", "-XX:+UseConcMarkSweepGC", "-XX:MaxRAMPercentage=abc", "-Xfoo", "-Dapp=1"}
+	failure := "\nError: Could not create the Java Virtual Machine.\nError: A fatal exception has occurred. Program will exit.\n"
+
+	cases := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{
+			name:   "Unrecognized",
+			output: "Unrecognized VM option 'UseConcMarkSweepGC'" + failure,
+			want:   []string{"-XX:+UseConcMarkSweepGC"},
+		},
+		{
+			name:   "ImproperlySpecified",
+			output: "Improperly specified VM option 'MaxRAMPercentage=abc'" + failure,
+			want:   []string{"-XX:MaxRAMPercentage=abc"},
+		},
+		{
+			name:   "UnrecognizedOption",
+			output: "Unrecognized option: -Xfoo" + failure,
+			want:   []string{"-Xfoo"},
+		},
+		{
+			name:   "NotInOptions",
+			output: "Unrecognized VM option 'UseParNewGC'" + failure,
+		},
+		{
+			name:   "StartedFine",
+			output: "Unrecognized VM option 'UseConcMarkSweepGC' is just logged by the app",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tuner.InvalidOptions(tc.output, opts))
+		})
+	}
+}
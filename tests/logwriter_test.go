@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/runner"
+)
+
+func TestLogWriter(t *testing.T) {
+	var logs bytes.Buffer
+	logger, timeFormat := log.Logger, zerolog.TimeFieldFormat
+	log.Logger = zerolog.New(&logs)
+	// as set by console and plain log formats
+	zerolog.TimeFieldFormat = ""
+	defer func() { log.Logger, zerolog.TimeFieldFormat = logger, timeFormat }()
+
+	w := runner.NewLogWriter("stderr", func() int { return 42 }, regexp.MustCompile(runner.DefaultContinuation), &logs)
+	output := "Started\n" +
+		`{"level":"info","message":"already json"}` + "\n" +
+		"Exception in thread \"main\" java.lang.IllegalStateException: boom\n" +
+		"\tat com.example.App.main(App.java:10)\n" +
+		"Caused by: java.io.IOException: disk\n" +
+		"\t... 1 more\n" +
+		"\n" +
+		"Stopped"
+	// split writes, lines don't have to come whole
+	for _, chunk := range []string{output[:5], output[5:60], output[60:]} {
+		_, err := w.Write([]byte(chunk))
+		assert.NoError(t, err)
+	}
+	w.Flush()
+
+	messages := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		event := map[string]any{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &event))
+		messages = append(messages, event["message"].(string))
+		if event["message"] == "already json" {
+			assert.Equal(t, `{"level":"info","message":"already json"}`, line)
+			continue
+		}
+		assert.Equal(t, "stderr", event["stream"])
+		assert.Equal(t, 42.0, event["pid"])
+		_, err := time.Parse(time.RFC3339Nano, event["timestamp"].(string))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		"Started",
+		"already json",
+		"Exception in thread \"main\" java.lang.IllegalStateException: boom\n" +
+			"\tat com.example.App.main(App.java:10)\n" +
+			"Caused by: java.io.IOException: disk\n" +
+			"\t... 1 more",
+		"Stopped",
+	}, messages)
+}
+
+func TestLogWriter_SlowLine(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&logs)
+	defer func() { log.Logger = logger }()
+
+	w := runner.NewLogWriter("stdout", func() int { return 42 }, regexp.MustCompile(runner.DefaultContinuation), &logs)
+	_, err := w.Write([]byte("Started\nLoading con"))
+	assert.NoError(t, err)
+	// longer than the idle time of events
+	time.Sleep(300 * time.Millisecond)
+	_, err = w.Write([]byte("figuration\nLast line without newline"))
+	assert.NoError(t, err)
+	w.Flush()
+
+	messages := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		event := map[string]any{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &event))
+		messages = append(messages, event["message"].(string))
+	}
+	assert.Equal(t, []string{"Started", "Loading configuration", "Last line without newline"}, messages)
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestMigrateOptions(t *testing.T) {
+	legacy := []string{
+		"-XX:+UseConcMarkSweepGC",
+		"-XX:+UseParNewGC",
+		"-XX:CMSInitiatingOccupancyFraction=70",
+		"-XX:MaxPermSize=256m",
+		"-XX:+PrintGCDetails",
+		"-XX:+PrintGCDateStamps",
+		"-Xloggc:/var/log/gc.log",
+		"-XX:+AggressiveOpts",
+		"-Xss1m",
+	}
+	cases := []struct {
+		name        string
+		javaVersion string
+		want        []string
+		wantChanges int
+	}{
+		{"Java8", "1.8.0+462", []string{"-XX:+UseConcMarkSweepGC", "-XX:+UseParNewGC", "-XX:CMSInitiatingOccupancyFraction=70", "-XX:MaxMetaspaceSize=256m", "-XX:+PrintGCDetails", "-XX:+PrintGCDateStamps", "-Xloggc:/var/log/gc.log", "-XX:+AggressiveOpts", "-Xss1m"}, 1},
+		{"Java11", "11.0.28", []string{"-XX:+UseConcMarkSweepGC", "-XX:CMSInitiatingOccupancyFraction=70", "-XX:MaxMetaspaceSize=256m", "-Xlog:gc*", "-Xlog:gc*:file=/var/log/gc.log", "-Xss1m"}, 6},
+		{"Java21", "21.0.8", []string{"-XX:+UseG1GC", "-XX:MaxMetaspaceSize=256m", "-Xlog:gc*", "-Xlog:gc*:file=/var/log/gc.log", "-Xss1m"}, 8},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, changes, err := tuner.MigrateOptions(legacy, tc.javaVersion)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, opts)
+			assert.Len(t, changes, tc.wantChanges)
+		})
+	}
+}
+
+func TestMigrateOptions_Collectors(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		opts        []string
+		want        []string
+	}{
+		{"DisabledCMSJava11", "11.0.28", []string{"-XX:-UseConcMarkSweepGC"}, []string{"-XX:-UseConcMarkSweepGC"}},
+		{"DisabledCMSJava21", "21.0.8", []string{"-XX:-UseConcMarkSweepGC", "-Xss1m"}, []string{"-Xss1m"}},
+		{"EnabledCMSJava21", "21.0.8", []string{"-XX:+UseConcMarkSweepGC"}, []string{"-XX:+UseG1GC"}},
+		{"ParNewJava8", "1.8.0+462", []string{"-XX:+UseParNewGC", "-XX:-UseParNewGC"}, []string{"-XX:+UseParNewGC", "-XX:-UseParNewGC"}},
+		{"ParNewJava21", "21.0.8", []string{"-XX:+UseParNewGC", "-XX:-UseParNewGC", "-Xss1m"}, []string{"-Xss1m"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, _, err := tuner.MigrateOptions(tc.opts, tc.javaVersion)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, opts)
+		})
+	}
+}
+
+func TestMigrateOptions_Fail(t *testing.T) {
+	_, changes, err := tuner.MigrateOptions([]string{"-Xincgc", "-XX:+AggressiveOpts"}, "17.0.16")
+	assert.ErrorContains(t, err, "-Xincgc")
+	assert.Len(t, changes, 2)
+
+	opts, _, err := tuner.MigrateOptions([]string{"-Xincgc"}, "1.8.0+462")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-Xincgc"}, opts)
+}
+
+func TestMajorVersion(t *testing.T) {
+	assert.Equal(t, "v1.8", tuner.MajorVersion("8"))
+	assert.Equal(t, "v1.7", tuner.MajorVersion("v7"))
+	assert.Equal(t, "v21", tuner.MajorVersion("21"))
+	assert.Equal(t, "v1.8.462", tuner.MajorVersion("1.8.0+462"))
+}
@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestParseOption(t *testing.T) {
+	cases := []struct {
+		raw      string
+		wantKind string
+		wantKey  string
+		wantVal  string
+	}{
+		{"-XX:+UseG1GC", tuner.KindXXSwitch, "-XX:UseG1GC", "+"},
+		{"-XX:-UseG1GC", tuner.KindXXSwitch, "-XX:UseG1GC", "-"},
+		{"-XX:MaxRAMPercentage=60", tuner.KindXXValue, "-XX:MaxRAMPercentage", "60"},
+		{"-Dfile.encoding=UTF-8", tuner.KindProperty, "-Dfile.encoding", "UTF-8"},
+		{"-Dflag", tuner.KindProperty, "-Dflag", ""},
+		{"-Xmx512m", tuner.KindXSize, "-Xmx", "512m"},
+		{"-Xss1m", tuner.KindXSize, "-Xss", "1m"},
+		{"-Xshare:off", tuner.KindX, "-Xshare", "off"},
+		{"-Xlog:gc", tuner.KindX, "-Xlog:gc", "gc"},
+		{"--add-opens=java.base/java.lang=ALL-UNNAMED", tuner.KindModule, "--add-opens=java.base/java.lang=ALL-UNNAMED", "java.base/java.lang=ALL-UNNAMED"},
+		{"-javaagent:/opt/agent.jar=debug", tuner.KindAgent, "-javaagent:/opt/agent.jar", "debug"},
+		{"-server", tuner.KindOther, "-server", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.raw, func(t *testing.T) {
+			opt := tuner.ParseOption(tc.raw, tuner.OriginUser)
+			assert.Equal(t, tc.wantKind, opt.Kind)
+			assert.Equal(t, tc.wantKey, opt.Key())
+			assert.Equal(t, tc.wantVal, opt.Value)
+			assert.Equal(t, tc.raw, opt.String())
+		})
+	}
+}
+
+func TestParseOptions_SeparateValue(t *testing.T) {
+	opts := tuner.ParseOptions([]string{"--add-opens", "java.base/java.lang=ALL-UNNAMED", "-Xss1m"}, tuner.OriginUser)
+	assert.Len(t, opts, 2)
+	assert.Equal(t, "--add-opens=java.base/java.lang=ALL-UNNAMED", opts[0].Raw)
+}
+
+func TestMergeOptions(t *testing.T) {
+	merged := tuner.MergeOptions(
+		tuner.ParseOptions([]string{"-Xshare:off", "-XX:+AlwaysActAsServerClassMachine"}, tuner.OriginProfile),
+		tuner.ParseOptions([]string{"-Xshare:auto", "-Xss512k", "-Xss1m", "-Xlog:gc", "-Xlog:safepoint"}, tuner.OriginUser),
+		tuner.ParseOptions([]string{"-Xss256k", "-XX:MaxRAMPercentage=70.0", "-XX:+AlwaysActAsServerClassMachine"}, tuner.OriginDefault),
+	)
+
+	args := []string{}
+	origins := []string{}
+	for _, opt := range merged {
+		args = append(args, opt.String())
+		origins = append(origins, opt.Origin)
+	}
+	assert.Equal(t, []string{"-Xshare:auto", "-XX:+AlwaysActAsServerClassMachine", "-Xss1m", "-Xlog:gc", "-Xlog:safepoint", "-XX:MaxRAMPercentage=70.0"}, args)
+	assert.Equal(t, []string{tuner.OriginUser, tuner.OriginProfile, tuner.OriginUser, tuner.OriginUser, tuner.OriginUser, tuner.OriginDefault}, origins)
+}
+
+func TestTune_UserPrecedence(t *testing.T) {
+	opts, err := tuner.Tune(tuner.Params{
+		JavaVersion:   "v17.0.16",
+		CPUCount:      2,
+		MemLimit:      2 * tuner.GiB,
+		MemPercentage: 70.0,
+		OtherFlags:    []string{"-XX:MaxRAMPercentage=60", "-XX:+AlwaysActAsServerClassMachine", "-XX:ActiveProcessorCount=4"},
+	})
+	assert.NoError(t, err)
+	args := tuner.FormatOptions(opts)
+	assert.Contains(t, args, "-XX:MaxRAMPercentage=60")
+	assert.NotContains(t, args, "-XX:MaxRAMPercentage=70.0")
+	assert.Contains(t, args, "-XX:ActiveProcessorCount=4")
+	assert.NotContains(t, args, "-XX:ActiveProcessorCount=2")
+
+	count := 0
+	for _, arg := range args {
+		if arg == "-XX:+AlwaysActAsServerClassMachine" {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+}
+
+func TestTune_UserHeapPrecedence(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		flags       []string
+		calculator  bool
+		wantFlags   []string
+		notFlags    []string
+	}{
+		{
+			name:        "PercentageOverMaxHeap",
+			javaVersion: "v17.0.16",
+			flags:       []string{"-XX:MaxRAMPercentage=50"},
+			wantFlags:   []string{"-XX:MaxRAMPercentage=50"},
+			notFlags:    []string{"-Xmx256m"},
+		},
+		{
+			name:        "PercentageOverCalculator",
+			javaVersion: "v17.0.16",
+			flags:       []string{"-XX:MaxRAMPercentage=50"},
+			calculator:  true,
+			wantFlags:   []string{"-XX:MaxRAMPercentage=50", "-XX:ReservedCodeCacheSize=240m"},
+		},
+		{
+			name:        "InitialHeapSizeJava8",
+			javaVersion: "1.8.0+102",
+			flags:       []string{"-XX:InitialHeapSize=128m"},
+			wantFlags:   []string{"-XX:InitialHeapSize=128m", "-Xmx256m"},
+			notFlags:    []string{"-Xms256m"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   tc.javaVersion,
+				CPUCount:      2,
+				MemLimit:      1 * tuner.GiB,
+				MemPercentage: 70.0,
+				MaxHeap:       256 * tuner.MiB,
+				Calculator:    tuner.MemoryCalculator{Enabled: tc.calculator, ClassCount: 10000},
+				OtherFlags:    tc.flags,
+			})
+			assert.NoError(t, err)
+			args := tuner.ApplyRules(tuner.FormatOptions(opts), tc.javaVersion)
+			for _, flag := range tc.wantFlags {
+				assert.Contains(t, args, flag)
+			}
+			for _, flag := range tc.notFlags {
+				assert.NotContains(t, args, flag)
+			}
+			for _, arg := range args {
+				if tc.javaVersion == "v17.0.16" {
+					assert.NotRegexp(t, `^-Xm[xs]`, arg)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveOptions(t *testing.T) {
+	opts := []string{"-Xshare:off", "-XX:+UseStringDeduplication", "-XX:MaxRAMPercentage=70.0", "-XX:MaxRAM=924m", "-Dnetworkaddress.cache.ttl=10", "-Xss1m"}
+	cases := []struct {
+		name        string
+		patterns    []string
+		wantKept    []string
+		wantRemoved []string
+	}{
+		{"None", nil, opts, []string{}},
+		{"Exact", []string{"-Xss1m"}, opts[:5], []string{"-Xss1m"}},
+		{"ExactOtherValue", []string{"-Xss2m"}, opts, []string{}},
+		{"Name", []string{"-Xshare", "-XX:MaxRAM"}, []string{"-XX:+UseStringDeduplication", "-XX:MaxRAMPercentage=70.0", "-Dnetworkaddress.cache.ttl=10", "-Xss1m"}, []string{"-Xshare:off", "-XX:MaxRAM=924m"}},
+		{"Glob", []string{"-XX:*StringDeduplication", "-Dnetworkaddress.*"}, []string{"-Xshare:off", "-XX:MaxRAMPercentage=70.0", "-XX:MaxRAM=924m", "-Xss1m"}, []string{"-XX:+UseStringDeduplication", "-Dnetworkaddress.cache.ttl=10"}},
+		{"GlobName", []string{"-XX:MaxRAM*"}, []string{"-Xshare:off", "-XX:+UseStringDeduplication", "-Dnetworkaddress.cache.ttl=10", "-Xss1m"}, []string{"-XX:MaxRAMPercentage=70.0", "-XX:MaxRAM=924m"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kept, removed := tuner.RemoveOptions(opts, tc.patterns)
+			assert.Equal(t, tc.wantKept, kept)
+			assert.Equal(t, tc.wantRemoved, removed)
+		})
+	}
+}
+
+func TestRemoveOptions_Paths(t *testing.T) {
+	opts := []string{"-javaagent:/opt/a.jar", "-Xlog:gc*:file=/var/log/gc.log", "-Djava.io.tmpdir=/tmp/app", "-Xss1m"}
+	cases := []struct {
+		name        string
+		patterns    []string
+		wantRemoved []string
+	}{
+		{"Agent", []string{"-javaagent:*"}, []string{"-javaagent:/opt/a.jar"}},
+		{"AgentJar", []string{"-javaagent:*/a.jar"}, []string{"-javaagent:/opt/a.jar"}},
+		{"Log", []string{"-Xlog:gc*"}, []string{"-Xlog:gc*:file=/var/log/gc.log"}},
+		{"Property", []string{"-Djava.io.tmpdir=/tmp/*"}, []string{"-Djava.io.tmpdir=/tmp/app"}},
+		{"SingleCharacter", []string{"-Xss?m"}, []string{"-Xss1m"}},
+		{"Class", []string{"-Xss[!2]m"}, []string{"-Xss1m"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, removed := tuner.RemoveOptions(opts, tc.patterns)
+			assert.Equal(t, tc.wantRemoved, removed)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestPolicy_Evaluate(t *testing.T) {
+	policy := tuner.Policy{
+		Mode:      tuner.PolicyEnforce,
+		Required:  []tuner.PolicyRule{{Pattern: "-XX:+ExitOnOutOfMemoryError"}, {Pattern: "-Xss"}},
+		Forbidden: []tuner.PolicyRule{{Pattern: "-agentlib:jdwp=*", Reason: "no remote debugging"}, {Pattern: "-javaagent:*"}},
+		Ranges: []tuner.PolicyRange{
+			{Option: "-XX:MaxRAMPercentage", Min: "50", Max: "80"},
+			{Option: "-Xmx", Max: "4g"},
+		},
+	}
+
+	cases := []struct {
+		name       string
+		opts       []string
+		memLimit   uint64
+		violations []string
+	}{
+		{
+			name: "Compliant",
+			opts: []string{"-XX:+ExitOnOutOfMemoryError", "-Xss1m", "-XX:MaxRAMPercentage=75.0"},
+		},
+		{
+			name:       "MissingRequired",
+			opts:       []string{"-Xss1m"},
+			violations: []string{"-XX:+ExitOnOutOfMemoryError"},
+		},
+		{
+			name:       "Forbidden",
+			opts:       []string{"-XX:+ExitOnOutOfMemoryError", "-Xss1m", "-agentlib:jdwp=transport=dt_socket"},
+			violations: []string{"-agentlib:jdwp=transport=dt_socket"},
+		},
+		{
+			name:       "ForbiddenPath",
+			opts:       []string{"-XX:+ExitOnOutOfMemoryError", "-Xss1m", "-javaagent:/opt/agents/agent.jar=config.yaml"},
+			violations: []string{"-javaagent:/opt/agents/agent.jar=config.yaml"},
+		},
+		{
+			name:       "OutOfRange",
+			opts:       []string{"-XX:+ExitOnOutOfMemoryError", "-Xss1m", "-XX:MaxRAMPercentage=85.0", "-Xmx8g"},
+			violations: []string{"-XX:MaxRAMPercentage=85.0", "-Xmx8g"},
+		},
+		{
+			name:       "BelowRange",
+			opts:       []string{"-XX:+ExitOnOutOfMemoryError", "-Xss1m", "-XX:MaxRAMPercentage=25", "-Xmx2g"},
+			violations: []string{"-XX:MaxRAMPercentage=25"},
+		},
+		{
+			name:       "HeapAbovePercentage",
+			opts:       []string{"-XX:+ExitOnOutOfMemoryError", "-Xss1m", "-Xmx3500m", "-XX:MaxRAM=4g"},
+			violations: []string{"-Xmx3500m"},
+		},
+		{
+			name:       "HeapBelowPercentage",
+			opts:       []string{"-XX:+ExitOnOutOfMemoryError", "-Xss1m", "-XX:MaxHeapSize=1g"},
+			memLimit:   4 * tuner.GiB,
+			violations: []string{"-XX:MaxHeapSize=1g"},
+		},
+		{
+			name:     "HeapInPercentage",
+			opts:     []string{"-XX:+ExitOnOutOfMemoryError", "-Xss1m", "-Xmx3g"},
+			memLimit: 4 * tuner.GiB,
+		},
+		{
+			name: "ForbiddenInEnvironment",
+			opts: tuner.EffectiveOptions(
+				[]string{"-XX:+ExitOnOutOfMemoryError", "-Xss1m"},
+				[]string{"JAVA_TOOL_OPTIONS=-agentlib:jdwp=transport=dt_socket,server=y"},
+			),
+			violations: []string{"-agentlib:jdwp=transport=dt_socket,server=y"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			options := []string{}
+			for _, violation := range policy.Evaluate(tc.opts, tc.memLimit) {
+				options = append(options, violation.Option)
+			}
+			assert.ElementsMatch(t, tc.violations, options)
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+required:
+  - pattern: -XX:+ExitOnOutOfMemoryError
+forbidden:
+  - pattern: -agentlib:jdwp=*
+    reason: no remote debugging
+ranges:
+  - option: -XX:MaxRAMPercentage
+    min: 50
+    max: 80
+`), 0o644))
+
+	policy, err := tuner.LoadPolicy(path)
+	assert.NoError(t, err)
+	assert.Equal(t, tuner.Policy{
+		Mode:      tuner.PolicyEnforce,
+		Required:  []tuner.PolicyRule{{Pattern: "-XX:+ExitOnOutOfMemoryError"}},
+		Forbidden: []tuner.PolicyRule{{Pattern: "-agentlib:jdwp=*", Reason: "no remote debugging"}},
+		Ranges:    []tuner.PolicyRange{{Option: "-XX:MaxRAMPercentage", Min: "50", Max: "80"}},
+	}, policy)
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	assert.NoError(t, os.WriteFile(invalid, []byte("mode: block\n"), 0o644))
+	_, err = tuner.LoadPolicy(invalid)
+	assert.ErrorContains(t, err, "unknown mode")
+
+	assert.NoError(t, os.WriteFile(invalid, []byte("ranges:\n  - option: -Xmx\n    max: lots\n"), 0o644))
+	_, err = tuner.LoadPolicy(invalid)
+	assert.ErrorContains(t, err, "invalid range")
+}
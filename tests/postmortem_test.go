@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+const hsErrFile = `#
+# A fatal error has been detected by the Java Runtime Environment:
+#
+#  SIGSEGV (0xb) at pc=0x00007f3c2d0b1e2a, pid=1, tid=7
+#
+# JRE version: OpenJDK Runtime Environment Temurin-21.0.2+13 (21.0.2+13) (build 21.0.2+13-LTS)
+# Java VM: OpenJDK 64-Bit Server VM Temurin-21.0.2+13 (21.0.2+13-LTS, mixed mode, sharing, tiered, compressed oops, g1 gc, linux-amd64)
+# Problematic frame:
+# C  [libc.so.6+0x1a0e2a]  __memmove_avx_unaligned_erms+0x6a
+#
+
+---------------  P R O C E S S  ---------------
+
+Heap:
+ garbage-first heap   total 262144K, used 21504K [0x00000000f0000000, 0x0000000100000000)
+
+---------------  S Y S T E M  ---------------
+
+Memory: 4k page, physical 16318204k(8123456k free), swap 0k(0k free)
+`
+
+const hsErrFileNative = `#
+# There is insufficient memory for the Java Runtime Environment to continue.
+# Native memory allocation (mmap) failed to map 65536 bytes for committing reserved memory.
+# Possible reasons:
+#
+# JRE version: OpenJDK Runtime Environment (17.0.2+8) (build 17.0.2+8-86)
+`
+
+func TestPostMortemOptions(t *testing.T) {
+	opts := tuner.PostMortemOptions([]string{"-Xmx1g"}, "/crash")
+	assert.Equal(t, []string{
+		"-Xmx1g",
+		"-XX:ErrorFile=/crash/hs_err_pid%p.log",
+		"-XX:ReplayDataFile=/crash/replay_pid%p.log",
+		"-XX:HeapDumpPath=/crash",
+	}, opts)
+
+	opts = tuner.PostMortemOptions([]string{"-XX:ErrorFile=/logs/err.log", "-XX:HeapDumpPath=/dumps/heap.hprof"}, "/crash")
+	assert.Equal(t, []string{
+		"-XX:ErrorFile=/logs/err.log",
+		"-XX:HeapDumpPath=/dumps/heap.hprof",
+		"-XX:ReplayDataFile=/crash/replay_pid%p.log",
+	}, opts)
+
+	assert.Equal(t, tuner.CrashFiles{
+		ErrorFile:    "/logs/err.log",
+		ReplayFile:   "/crash/replay_pid%p.log",
+		HeapDumpPath: "/dumps/heap.hprof",
+	}, tuner.CrashFilesOf(opts))
+}
+
+func TestCrashFiles_Find(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Now().Add(-time.Second)
+	for _, name := range []string{"hs_err_pid42.log", "java_pid42.hprof", "hs_err_pid7.log"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644))
+	}
+
+	files := tuner.CrashFilesOf(tuner.PostMortemOptions(nil, dir))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "hs_err_pid42.log"),
+		filepath.Join(dir, "java_pid42.hprof"),
+	}, files.Find(42, started))
+	assert.Empty(t, files.Find(42, time.Now().Add(time.Hour)), "files older than the run are ignored")
+}
+
+func TestParseErrorFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hs_err_pid1.log")
+	assert.NoError(t, os.WriteFile(path, []byte(hsErrFile), 0o644))
+
+	report, err := tuner.ParseErrorFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, tuner.CrashReport{
+		Error:            "SIGSEGV (0xb) at pc=0x00007f3c2d0b1e2a, pid=1, tid=7",
+		ProblematicFrame: "C  [libc.so.6+0x1a0e2a]  __memmove_avx_unaligned_erms+0x6a",
+		JREVersion:       "OpenJDK Runtime Environment Temurin-21.0.2+13 (21.0.2+13) (build 21.0.2+13-LTS)",
+		JavaVM:           "OpenJDK 64-Bit Server VM Temurin-21.0.2+13 (21.0.2+13-LTS, mixed mode, sharing, tiered, compressed oops, g1 gc, linux-amd64)",
+		Memory:           "4k page, physical 16318204k(8123456k free), swap 0k(0k free)",
+		Heap:             "garbage-first heap total 262144K, used 21504K [0x00000000f0000000, 0x0000000100000000)",
+	}, report)
+
+	assert.NoError(t, os.WriteFile(path, []byte(hsErrFileNative), 0o644))
+	report, err = tuner.ParseErrorFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "There is insufficient memory for the Java Runtime Environment to continue. Native memory allocation (mmap) failed to map 65536 bytes for committing reserved memory.", report.Error)
+	assert.Equal(t, "OpenJDK Runtime Environment (17.0.2+8) (build 17.0.2+8-86)", report.JREVersion)
+
+	_, err = tuner.ParseErrorFile(filepath.Join(dir, "missing.log"))
+	assert.Error(t, err)
+}
+
+func TestCopyCrashFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hs_err_pid42.log")
+	assert.NoError(t, os.WriteFile(path, []byte(hsErrFile), 0o644))
+
+	target, err := tuner.CopyCrashFiles([]string{path}, filepath.Join(dir, "volume"), 42)
+	assert.NoError(t, err)
+	assert.Contains(t, filepath.Base(target), "-pid42")
+	content, err := os.ReadFile(filepath.Join(target, "hs_err_pid42.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, hsErrFile, string(content))
+}
+
+func TestFinalOptions_RemovePostMortem(t *testing.T) {
+	opts, err := tuner.Tune(tuner.Params{
+		JavaVersion:   "v17.0.16",
+		CPUCount:      2,
+		MemLimit:      1 * tuner.GiB,
+		MemPercentage: 70.0,
+	})
+	assert.NoError(t, err)
+	validate := func(opts, _ []string) ([]string, error) {
+		return append(opts, "-XX:+UnlockDiagnosticVMOptions"), nil
+	}
+
+	dir := t.TempDir()
+	args, removed, err := tuner.FinalOptions(opts, "v17.0.16", dir, validate, []string{"-XX:HeapDumpPath", "-XX:+UnlockDiagnosticVMOptions"})
+	assert.NoError(t, err)
+	assert.Contains(t, args, "-XX:ErrorFile="+filepath.Join(dir, "hs_err_pid%p.log"))
+	assert.NotContains(t, args, "-XX:HeapDumpPath="+dir)
+	assert.NotContains(t, args, "-XX:+UnlockDiagnosticVMOptions")
+	assert.ElementsMatch(t, []string{"-XX:HeapDumpPath=" + dir, "-XX:+UnlockDiagnosticVMOptions"}, removed)
+
+	_, _, err = tuner.FinalOptions(opts, "v17.0.16", "", func(_, _ []string) ([]string, error) {
+		return nil, errors.New("invalid")
+	}, nil)
+	assert.Error(t, err)
+}
+
+func TestFinalOptions_UserOptions(t *testing.T) {
+	opts, err := tuner.Tune(tuner.Params{
+		JavaVersion:   "v17.0.16",
+		CPUCount:      2,
+		MemLimit:      1 * tuner.GiB,
+		MemPercentage: 70.0,
+		OtherFlags:    []string{"-XX:+UseG1GCC", "-Dapp=1"},
+	})
+	assert.NoError(t, err)
+
+	var userArgs []string
+	_, _, err = tuner.FinalOptions(opts, "v17.0.16", "", func(args, user []string) ([]string, error) {
+		userArgs = user
+		return args, nil
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-XX:+UseG1GCC", "-Dapp=1"}, userArgs)
+}
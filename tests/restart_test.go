@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/runner"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestExitStatus_Cause(t *testing.T) {
+	cases := []struct {
+		status   runner.ExitStatus
+		expected string
+	}{
+		{runner.ExitStatus{}, runner.ExitNormal},
+		{runner.ExitStatus{Code: 1}, runner.ExitFailure},
+		{runner.ExitStatus{Code: 3}, runner.ExitOutOfMemory},
+		{runner.ExitStatus{Signal: syscall.SIGKILL}, runner.ExitOOMKilled},
+		{runner.ExitStatus{Code: 137}, runner.ExitOOMKilled},
+		{runner.ExitStatus{Signal: syscall.SIGABRT}, runner.ExitCrash},
+		{runner.ExitStatus{Code: 134}, runner.ExitCrash},
+		{runner.ExitStatus{Signal: syscall.SIGTERM}, runner.ExitFailure},
+		{runner.ExitStatus{Signal: syscall.SIGKILL, Stopped: true}, runner.ExitStopped},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.status.Cause())
+		})
+	}
+}
+
+func TestExitStatus_Describe(t *testing.T) {
+	cases := []struct {
+		status   runner.ExitStatus
+		expected string
+	}{
+		{runner.ExitStatus{}, "exited normally"},
+		{runner.ExitStatus{Code: 1}, "1: exited with an error"},
+		{runner.ExitStatus{Code: 3}, "3: Java heap exhausted, exited by -XX:+ExitOnOutOfMemoryError"},
+		{runner.ExitStatus{Signal: syscall.SIGKILL}, "137: SIGKILL, probably killed by the OOM killer, the memory limit is too low"},
+		{runner.ExitStatus{Code: 134}, "134: SIGABRT, the JVM crashed"},
+		{runner.ExitStatus{Signal: syscall.SIGTERM}, "143: killed by SIGTERM"},
+		{runner.ExitStatus{Signal: syscall.SIGTERM, Stopped: true}, "143: stopped on request"},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.expected, tc.status.Describe())
+	}
+}
+
+func TestRestartPolicy_Restarts(t *testing.T) {
+	normal := runner.ExitStatus{}
+	failure := runner.ExitStatus{Code: 1}
+	stopped := runner.ExitStatus{Signal: syscall.SIGTERM, Stopped: true}
+
+	never := runner.RestartPolicy{Mode: runner.RestartNever}
+	assert.False(t, never.Restarts(failure))
+
+	onFailure := runner.RestartPolicy{Mode: runner.RestartOnFailure}
+	assert.True(t, onFailure.Restarts(failure))
+	assert.True(t, onFailure.Restarts(runner.ExitStatus{Signal: syscall.SIGKILL}))
+	assert.False(t, onFailure.Restarts(normal))
+	assert.False(t, onFailure.Restarts(stopped))
+
+	always := runner.RestartPolicy{Mode: runner.RestartAlways}
+	assert.True(t, always.Restarts(normal))
+	assert.True(t, always.Restarts(failure))
+	assert.False(t, always.Restarts(stopped))
+}
+
+func TestRestartPolicy_Delay(t *testing.T) {
+	policy := runner.RestartPolicy{Mode: runner.RestartAlways, MaxAttempts: 12, Backoff: time.Second}
+
+	cases := []struct {
+		attempt  int
+		expected time.Duration
+		ok       bool
+	}{
+		{1, time.Second, true},
+		{2, 2 * time.Second, true},
+		{4, 8 * time.Second, true},
+		{12, runner.MaxRestartBackoff, true},
+		{13, 0, false},
+	}
+	for _, tc := range cases {
+		delay, ok := policy.Delay(tc.attempt)
+		assert.Equal(t, tc.ok, ok, "attempt %d", tc.attempt)
+		assert.Equal(t, tc.expected, delay, "attempt %d", tc.attempt)
+	}
+
+	policy.MaxAttempts = 0
+	_, ok := policy.Delay(100)
+	assert.True(t, ok, "no limit of attempts")
+}
+
+func TestReduceHeap(t *testing.T) {
+	params := tuner.Params{MemLimit: 1000 * tuner.MiB, MemPercentage: 80, Headroom: 100 * tuner.MiB}
+
+	assert.Equal(t, params, tuner.ReduceHeap(params, 0))
+	assert.InDelta(t, 72.0, tuner.ReduceHeap(params, 1).MemPercentage, 0.001)
+	assert.InDelta(t, 64.8, tuner.ReduceHeap(params, 2).MemPercentage, 0.001)
+
+	params.Calculator.Enabled = true
+	reduced := tuner.ReduceHeap(params, 1)
+	assert.Equal(t, 80.0, reduced.MemPercentage)
+	assert.InDelta(t, float64(200*tuner.MiB), float64(reduced.Headroom), float64(tuner.MiB))
+}
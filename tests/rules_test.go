@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestApplyRules(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		opts        []string
+		want        []string
+	}{
+		{
+			name:        "NoIssues",
+			javaVersion: "v17.0.16",
+			opts:        []string{"-XX:+UseG1GC", "-XX:+UseStringDeduplication", "-XX:MaxRAMPercentage=70.0"},
+			want:        []string{"-XX:+UseG1GC", "-XX:+UseStringDeduplication", "-XX:MaxRAMPercentage=70.0"},
+		},
+		{
+			name:        "LastGCWins",
+			javaVersion: "v17.0.16",
+			opts:        []string{"-XX:+UseParallelGC", "-Xss1m", "-XX:+UseG1GC"},
+			want:        []string{"-Xss1m", "-XX:+UseG1GC"},
+		},
+		{
+			name:        "DedupWithoutG1",
+			javaVersion: "v11.0.28",
+			opts:        []string{"-XX:+UseStringDeduplication", "-XX:+UseParallelGC"},
+			want:        []string{"-XX:+UseParallelGC"},
+		},
+		{
+			name:        "DedupJava18",
+			javaVersion: "v21.0.8",
+			opts:        []string{"-XX:+UseStringDeduplication", "-XX:+UseParallelGC"},
+			want:        []string{"-XX:+UseStringDeduplication", "-XX:+UseParallelGC"},
+		},
+		{
+			name:        "XmxSupersedesPercentage",
+			javaVersion: "v17.0.16",
+			opts:        []string{"-Xmx2g", "-XX:MaxRAMPercentage=70.0", "-XX:InitialRAMPercentage=25.0", "-XX:MinRAMPercentage=25.0"},
+			want:        []string{"-Xmx2g", "-XX:InitialRAMPercentage=25.0"},
+		},
+		{
+			name:        "XmsSupersedesPercentage",
+			javaVersion: "v17.0.16",
+			opts:        []string{"-XX:InitialRAMPercentage=25.0", "-Xms1g"},
+			want:        []string{"-Xms1g"},
+		},
+		{
+			name:        "UnlockExperimental",
+			javaVersion: "v11.0.28",
+			opts:        []string{"-Xss1m", "-XX:+UseZGC"},
+			want:        []string{"-Xss1m", "-XX:+UnlockExperimentalVMOptions", "-XX:+UseZGC"},
+		},
+		{
+			name:        "AlreadyUnlocked",
+			javaVersion: "1.8.0+131",
+			opts:        []string{"-XX:+UnlockExperimentalVMOptions", "-XX:+UseCGroupMemoryLimitForHeap"},
+			want:        []string{"-XX:+UnlockExperimentalVMOptions", "-XX:+UseCGroupMemoryLimitForHeap"},
+		},
+		{
+			name:        "ProductZGC",
+			javaVersion: "v17.0.16",
+			opts:        []string{"-XX:+UseZGC"},
+			want:        []string{"-XX:+UseZGC"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tuner.ApplyRules(tc.opts, tc.javaVersion))
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		input string
+		want  uint64
+	}{
+		{"1024", 1024},
+		{"512k", 512 * tuner.KiB},
+		{"512Mi", 512 * tuner.MiB},
+		{"512m", 512 * tuner.MiB},
+		{"2G", 2 * tuner.GiB},
+		{"2gb", 2 * tuner.GiB},
+		{"1.5Gi", 1536 * tuner.MiB},
+		{" 1T ", tuner.TiB},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			size, err := tuner.ParseSize(tc.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, size)
+		})
+	}
+}
+
+func TestParseSize_Invalid(t *testing.T) {
+	for _, input := range []string{"", "Mi", "12X", "1..5G", "-1G"} {
+		t.Run(input, func(t *testing.T) {
+			_, err := tuner.ParseSize(input)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "2g", tuner.FormatSize(2*tuner.GiB))
+	assert.Equal(t, "1536m", tuner.FormatSize(1536*tuner.MiB))
+	assert.Equal(t, "512k", tuner.FormatSize(512*tuner.KiB))
+	assert.Equal(t, "1000", tuner.FormatSize(1000))
+}
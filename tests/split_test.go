@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestSplitOpts(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"Empty", "", []string{}},
+		{"Spaces", "  -Xss1m \t -Dfoo=bar\n", []string{"-Xss1m", "-Dfoo=bar"}},
+		{"DoubleQuotes", `-Dapp.banner="hello world"`, []string{"-Dapp.banner=hello world"}},
+		{"OnOutOfMemoryError", `-XX:OnOutOfMemoryError="kill -9 %p" -Xss1m`, []string{"-XX:OnOutOfMemoryError=kill -9 %p", "-Xss1m"}},
+		{"SingleQuotes", `'-Dmsg=it''s "quoted"'`, []string{`-Dmsg=its "quoted"`}},
+		{"SingleQuotesNoEscapes", `'-Dpath=C:\temp'`, []string{`-Dpath=C:\temp`}},
+		{"EscapedSpace", `-Dname=hello\ world`, []string{"-Dname=hello world"}},
+		{"EscapedQuote", `-Dq=\"x\"`, []string{`-Dq="x"`}},
+		{"EscapesInDoubleQuotes", `"-Dq=a\"b\\c\d"`, []string{`-Dq=a"b\c\d`}},
+		{"EmptyQuotes", `-Dempty="" ''`, []string{"-Dempty=", ""}},
+		{"LineContinuation", "-Xss1m \\\n-Dfoo=bar", []string{"-Xss1m", "-Dfoo=bar"}},
+		{"VariablesKept", `-Dhome=$HOME "-Duser=${USER}"`, []string{"-Dhome=$HOME", "-Duser=${USER}"}},
+		{"SubstitutionInSingleQuotes", `'-Dcmd=$(date)'`, []string{"-Dcmd=$(date)"}},
+		{"EscapedSubstitution", `"-Dcmd=\$(date)"`, []string{"-Dcmd=$(date)"}},
+		{"Mixed", `-Da="x y"'z w'v`, []string{"-Da=x yz wv"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			words, err := tuner.SplitOpts(tc.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, words)
+		})
+	}
+}
+
+func TestSplitOpts_Invalid(t *testing.T) {
+	for _, input := range []string{
+		`-Dapp="unterminated`,
+		`-Dapp='unterminated`,
+		`-Dapp=trailing\`,
+		"-Dcmd=`date`",
+		`-Dcmd=$(date)`,
+		`"-Dcmd=$(date)"`,
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := tuner.SplitOpts(input)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestJoinOpts(t *testing.T) {
+	cases := []struct {
+		name  string
+		words []string
+		want  string
+	}{
+		{"Plain", []string{"-Xss1m", "-Dfoo=bar"}, "-Xss1m -Dfoo=bar"},
+		{"Spaces", []string{"-Dfoo=a b", "-Xmx1g"}, "'-Dfoo=a b' -Xmx1g"},
+		{"SingleQuote", []string{"-Dmsg=it's"}, `'-Dmsg=it'"'"'s'`},
+		{"Special", []string{`-Dq="x"`, `-Dpath=C:\temp`, "-Dhome=$HOME", ""}, `'-Dq="x"' '-Dpath=C:\temp' '-Dhome=$HOME' ''`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			joined := tuner.JoinOpts(tc.words)
+			assert.Equal(t, tc.want, joined)
+			words, err := tuner.SplitOpts(joined)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.words, words)
+		})
+	}
+}
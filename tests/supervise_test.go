@@ -0,0 +1,102 @@
+//go:build linux
+
+package tests
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/runner"
+)
+
+func TestSupervise(t *testing.T) {
+	cases := []struct {
+		name     string
+		script   string
+		expected runner.ExitStatus
+		code     int
+	}{
+		{name: "Success", script: "exit 0", expected: runner.ExitStatus{}, code: 0},
+		{name: "ExitCode", script: "exit 7", expected: runner.ExitStatus{Code: 7}, code: 7},
+		{name: "Signal", script: "kill -TERM $$", expected: runner.ExitStatus{Signal: syscall.SIGTERM}, code: 143},
+		{name: "Orphans", script: "sleep 0.1 & exit 2", expected: runner.ExitStatus{Code: 2}, code: 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, err := runner.New("/bin/sh").Arg("-c", tc.script).Supervise()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, status)
+			assert.Equal(t, tc.code, status.ExitCode())
+		})
+	}
+}
+
+func TestSupervise_NotFound(t *testing.T) {
+	_, err := runner.New("/nonexistent/java").Supervise()
+	assert.Error(t, err)
+}
+
+func TestNewShutdown(t *testing.T) {
+	shutdown := runner.NewShutdown(30 * time.Second)
+	assert.Equal(t, 15*time.Second, shutdown.ThreadDumpAfter)
+	assert.Equal(t, 27*time.Second, shutdown.KillAfter)
+}
+
+func TestSupervise_Shutdown(t *testing.T) {
+	dumped := make(chan int, 1)
+	shutdown := runner.NewShutdown(time.Second)
+	shutdown.OnThreadDump = func(pid int) { dumped <- pid }
+
+	// ignores SIGTERM, so it has to be killed
+	java := runner.New("/bin/sh").Arg("-c", `trap "" TERM QUIT; while true; do sleep 0.1; done`).SetShutdown(shutdown)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}()
+	status, err := java.Supervise()
+	assert.NoError(t, err)
+	assert.Equal(t, runner.ExitStatus{Signal: syscall.SIGKILL, Stopped: true}, status)
+	assert.Len(t, dumped, 1)
+}
+
+func TestSupervise_Output(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	status, err := runner.New("/bin/sh").Arg("-c", "echo out; echo err >&2").SetOutput(&stdout, &stderr).Supervise()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, status.ExitCode())
+	assert.Equal(t, "out\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+}
+
+func TestSupervise_ShutdownHelper(t *testing.T) {
+	dumped := make(chan error, 1)
+	shutdown := runner.NewShutdown(2 * time.Second)
+	shutdown.OnThreadDump = func(pid int) {
+		// many short commands, like jcmd, each could be reaped by the supervisor
+		for range 100 {
+			if _, err := runner.New("/bin/echo").Arg("dumped").Output(); err != nil {
+				dumped <- err
+				return
+			}
+		}
+		dumped <- nil
+	}
+
+	// keeps leaving orphans, so the supervisor reaps while helpers run
+	java := runner.New("/bin/sh").Arg("-c", `trap "" TERM QUIT; while true; do (true &); (true &); sleep 0.005; done`).SetShutdown(shutdown)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}()
+	status, err := java.Supervise()
+	assert.NoError(t, err)
+	assert.Equal(t, runner.ExitStatus{Signal: syscall.SIGKILL, Stopped: true}, status)
+	if assert.Len(t, dumped, 1) {
+		assert.NoError(t, <-dumped)
+	}
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/java-tuner/pkg/tuner"
+)
+
+func TestValidateSyntax(t *testing.T) {
+	valid := []string{
+		"-XX:+UseG1GC",
+		"-XX:-UseCompressedOops",
+		"-XX:MaxRAMPercentage=70.0",
+		"-XX:OnError=",
+		"-Xmx512m",
+		"-Xms2G",
+		"-Xss1024k",
+		"-Xshare:off",
+		"-Xlog:gc*:file=gc.log",
+		"-Xbootclasspath/a:/opt/agent.jar",
+		"-Dnetworkaddress.cache.ttl=10",
+		"-Dflag",
+		"-javaagent:/opt/agent.jar=config.yaml",
+		"--add-opens=java.base/java.lang=ALL-UNNAMED",
+		"-ea",
+		"-verbose:gc",
+	}
+	for _, opt := range valid {
+		t.Run(opt, func(t *testing.T) {
+			assert.NoError(t, tuner.ValidateSyntax(opt))
+		})
+	}
+
+	invalid := []string{
+		"-Xmx=819m",
+		"-Xms=819m",
+		"-Xmx512mb",
+		"-XX:UseG1GC",
+		"-XX:+UseG1GC=true",
+		"-XX:+",
+		"-D=value",
+		" -Xmx1g",
+		"Xmx1g",
+		"",
+	}
+	for _, opt := range invalid {
+		t.Run(opt, func(t *testing.T) {
+			assert.Error(t, tuner.ValidateSyntax(opt))
+		})
+	}
+}
+
+func TestTune_Java8Updates(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		wantFlags   []string
+		notFlags    []string
+	}{
+		{
+			name:        "Java7",
+			javaVersion: "1.7.0+80",
+			wantFlags:   []string{"-Xmx1229m", "-Xms1229m", "-XX:CICompilerCount=1"},
+			notFlags:    []string{"-XX:+UseCGroupMemoryLimitForHeap", "-XX:MaxRAMPercentage=60.0", "-XX:ActiveProcessorCount=2", "-Djava.util.concurrent.ForkJoinPool.common.parallelism=1"},
+		},
+		{
+			name:        "Java8u102",
+			javaVersion: "1.8.0+102",
+			wantFlags:   []string{"-Xmx1229m", "-Xms1229m", "-XX:CICompilerCount=2", "-Djava.util.concurrent.ForkJoinPool.common.parallelism=1"},
+			notFlags:    []string{"-XX:+UseCGroupMemoryLimitForHeap", "-XX:MaxRAMPercentage=60.0", "-XX:ActiveProcessorCount=2"},
+		},
+		{
+			name:        "Java8u131",
+			javaVersion: "1.8.0+131",
+			wantFlags:   []string{"-Xmx1229m", "-Xms1229m"},
+			notFlags:    []string{"-XX:+UnlockExperimentalVMOptions", "-XX:+UseCGroupMemoryLimitForHeap", "-XX:MaxRAMPercentage=60.0"},
+		},
+		{
+			name:        "Java8u190",
+			javaVersion: "1.8.0+190",
+			wantFlags:   []string{"-Xmx1229m", "-Djava.util.concurrent.ForkJoinPool.common.parallelism=1"},
+			notFlags:    []string{"-XX:+UseCGroupMemoryLimitForHeap", "-XX:MaxRAMPercentage=60.0", "-XX:ActiveProcessorCount=2"},
+		},
+		{
+			name:        "Java8u191",
+			javaVersion: "1.8.0+191",
+			wantFlags:   []string{"-XX:MaxRAMPercentage=60.0", "-XX:InitialRAMPercentage=25.0", "-XX:ActiveProcessorCount=2"},
+			notFlags:    []string{"-Xmx1229m", "-XX:+UseCGroupMemoryLimitForHeap", "-Djava.util.concurrent.ForkJoinPool.common.parallelism=1"},
+		},
+		{
+			name:        "Java8u462Internal",
+			javaVersion: "1.8.0+462-internal",
+			wantFlags:   []string{"-XX:MaxRAMPercentage=60.0"},
+			notFlags:    []string{"-Xmx1229m"},
+		},
+		{
+			name:        "Java9",
+			javaVersion: "9.0.4",
+			wantFlags:   []string{"-Xmx1229m"},
+			notFlags:    []string{"-XX:+UseCGroupMemoryLimitForHeap", "-XX:MaxRAMPercentage=60.0"},
+		},
+		{
+			name:        "Java11",
+			javaVersion: "11.0.28",
+			wantFlags:   []string{"-XX:MaxRAMPercentage=60.0"},
+			notFlags:    []string{"-Xmx1229m", "-XX:+UseCGroupMemoryLimitForHeap"},
+		},
+		{
+			name:        "Java25Patch",
+			javaVersion: "25.0.1",
+			wantFlags:   []string{"-XX:MaxRAMPercentage=60.0"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   tc.javaVersion,
+				CPUCount:      2,
+				MemLimit:      2 * gb,
+				MemPercentage: 60.0,
+			})
+			assert.NoError(t, err)
+			args := tuner.FormatOptions(opts)
+			for _, flag := range tc.wantFlags {
+				assert.Contains(t, args, flag)
+			}
+			for _, flag := range tc.notFlags {
+				assert.NotContains(t, args, flag)
+			}
+			for _, arg := range args {
+				assert.NoError(t, tuner.ValidateSyntax(arg))
+			}
+		})
+	}
+}
@@ -16,7 +16,7 @@ func TestTune_Defaults(t *testing.T) {
 		{
 			name:        "Java8Defaults",
 			javaVersion: "v1.8.0",
-			wantFlags:   []string{"-XX:ActiveProcessorCount=2", "-Xmx=819m", "-Xms=819m", "-XX:MaxRAM=924m"},
+			wantFlags:   []string{"-Djava.util.concurrent.ForkJoinPool.common.parallelism=1", "-Xmx819m", "-Xms819m", "-XX:MaxRAM=924m"},
 		},
 		{
 			name:        "Java11Defaults",
@@ -27,7 +27,14 @@ func TestTune_Defaults(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			opts := tuner.Tune(tc.javaVersion, 2, 1024*1024*1024, 80.0, []string{})
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   tc.javaVersion,
+				CPUCount:      2,
+				MemLimit:      1024 * 1024 * 1024,
+				MemPercentage: 80.0,
+				OtherFlags:    []string{},
+			})
+			assert.NoError(t, err)
 			args := tuner.FormatOptions(opts)
 			for _, flag := range tc.wantFlags {
 				assert.Contains(t, args, flag)
@@ -52,8 +59,8 @@ func TestTune_LowMemory(t *testing.T) {
 			cpu:         1,
 			mem:         64 * 1024 * 1024,
 			maxRAMPct:   75.0,
-			wantFlags:   []string{"-XX:ActiveProcessorCount=1", "-Xmx=48m", "-Xms=48m"},
-			notFlags:    []string{"-XX:MaxRAM="},
+			wantFlags:   []string{"-Djava.util.concurrent.ForkJoinPool.common.parallelism=1", "-Xmx48m", "-Xms48m"},
+			notFlags:    []string{"-XX:MaxRAM=", "-XX:ActiveProcessorCount="},
 		},
 		{
 			name:        "Java11LowMem",
@@ -67,7 +74,14 @@ func TestTune_LowMemory(t *testing.T) {
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			opts := tuner.Tune(tc.javaVersion, tc.cpu, tc.mem, tc.maxRAMPct, []string{})
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   tc.javaVersion,
+				CPUCount:      tc.cpu,
+				MemLimit:      tc.mem,
+				MemPercentage: tc.maxRAMPct,
+				OtherFlags:    []string{},
+			})
+			assert.NoError(t, err)
 			args := tuner.FormatOptions(opts)
 			for _, flag := range tc.wantFlags {
 				assert.Contains(t, args, flag)
@@ -98,7 +112,7 @@ func TestTune_ExtraFlags(t *testing.T) {
 			mem:         2048 * 1024 * 1024,
 			maxRAMPct:   90.0,
 			extra:       []string{"-Dfoo=bar", "-XX:+UseG1GC"},
-			wantFlags:   []string{"-XX:ActiveProcessorCount=4", "-Xmx=1843m", "-Xms=1843m", "-XX:MaxRAM=1948m", "-Dfoo=bar", "-XX:+UseG1GC"},
+			wantFlags:   []string{"-Djava.util.concurrent.ForkJoinPool.common.parallelism=3", "-XX:ParallelGCThreads=4", "-Xmx1843m", "-Xms1843m", "-XX:MaxRAM=1948m", "-Dfoo=bar", "-XX:+UseG1GC"},
 		},
 		{
 			name:        "Java11ExtraFlags",
@@ -112,7 +126,14 @@ func TestTune_ExtraFlags(t *testing.T) {
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			opts := tuner.Tune(tc.javaVersion, tc.cpu, tc.mem, tc.maxRAMPct, tc.extra)
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   tc.javaVersion,
+				CPUCount:      tc.cpu,
+				MemLimit:      tc.mem,
+				MemPercentage: tc.maxRAMPct,
+				OtherFlags:    tc.extra,
+			})
+			assert.NoError(t, err)
 			args := tuner.FormatOptions(opts)
 			for _, flag := range tc.wantFlags {
 				assert.Contains(t, args, flag)
@@ -136,8 +157,9 @@ func TestTune_ZeroCPU(t *testing.T) {
 			cpu:         0,
 			mem:         512 * 1024 * 1024,
 			maxRAMPct:   50.0,
-			// detection happen eslewhere, but we still want to see the flags
-			wantFlags: []string{"-XX:ActiveProcessorCount=0", "-Xmx=256m", "-Xms=256m", "-XX:MaxRAM=412m"},
+			// detection happen eslewhere, but we still want to see the flags,
+			// Java 8 before 8u191 doesn't support ActiveProcessorCount
+			wantFlags: []string{"-Xmx256m", "-Xms256m", "-XX:MaxRAM=412m"},
 		},
 		{
 			name:        "Java11ZeroCPU",
@@ -150,11 +172,253 @@ func TestTune_ZeroCPU(t *testing.T) {
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			opts := tuner.Tune(tc.javaVersion, tc.cpu, tc.mem, tc.maxRAMPct, nil)
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   tc.javaVersion,
+				CPUCount:      tc.cpu,
+				MemLimit:      tc.mem,
+				MemPercentage: tc.maxRAMPct,
+				OtherFlags:    nil,
+			})
+			assert.NoError(t, err)
+			args := tuner.FormatOptions(opts)
+			for _, flag := range tc.wantFlags {
+				assert.Contains(t, args, flag)
+			}
+		})
+	}
+}
+
+func TestTune_Threads(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		gc          string
+		cpu         int
+		quota       float64
+		wantFlags   []string
+		notFlags    []string
+	}{
+		{
+			name:        "HalfCPUSerial",
+			javaVersion: "v17.0.16",
+			cpu:         1,
+			quota:       0.5,
+			wantFlags:   []string{"-XX:CICompilerCount=2"},
+			notFlags:    []string{"-XX:ParallelGCThreads=1", "-XX:ConcGCThreads=1"},
+		},
+		{
+			name:        "OneAndHalfCPUG1",
+			javaVersion: "v17.0.16",
+			gc:          tuner.GCG1,
+			cpu:         2,
+			quota:       1.5,
+			wantFlags:   []string{"-XX:ParallelGCThreads=1", "-XX:ConcGCThreads=1", "-XX:CICompilerCount=2"},
+		},
+		{
+			name:        "FourCPUParallel",
+			javaVersion: "v17.0.16",
+			gc:          tuner.GCParallel,
+			cpu:         4,
+			quota:       4,
+			wantFlags:   []string{"-XX:ParallelGCThreads=4", "-XX:CICompilerCount=3"},
+			notFlags:    []string{"-XX:ConcGCThreads=2"},
+		},
+		{
+			name:        "SixteenCPUG1",
+			javaVersion: "v21.0.8",
+			gc:          tuner.GCG1,
+			cpu:         16,
+			quota:       16,
+			wantFlags:   []string{"-XX:ParallelGCThreads=13", "-XX:ConcGCThreads=3", "-XX:CICompilerCount=12"},
+		},
+		{
+			name:        "Java7NoTiered",
+			javaVersion: "v1.7.0",
+			cpu:         1,
+			quota:       1,
+			wantFlags:   []string{"-XX:CICompilerCount=1"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   tc.javaVersion,
+				CPUCount:      tc.cpu,
+				CPUQuota:      tc.quota,
+				MemLimit:      8 * 1024 * 1024 * 1024,
+				MemPercentage: 70.0,
+				GC:            tc.gc,
+			})
+			assert.NoError(t, err)
+			for _, flag := range tc.wantFlags {
+				assert.Contains(t, opts.CPUOpts, flag)
+			}
+			for _, flag := range tc.notFlags {
+				assert.NotContains(t, opts.CPUOpts, flag)
+			}
+		})
+	}
+}
+
+func TestTune_HeapBounds(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		mem         uint64
+		minHeap     uint64
+		maxHeap     uint64
+		headroom    uint64
+		wantFlags   []string
+		notFlags    []string
+	}{
+		{
+			name:        "Java11WithinBounds",
+			javaVersion: "v11.0",
+			mem:         2 * gb,
+			minHeap:     512 * tuner.MiB,
+			maxHeap:     2 * gb,
+			wantFlags:   []string{"-XX:MaxRAMPercentage=70.0", "-XX:MaxRAM=1948m"},
+		},
+		{
+			name:        "Java11ClampedDown",
+			javaVersion: "v11.0",
+			mem:         8 * gb,
+			maxHeap:     2 * gb,
+			wantFlags:   []string{"-Xmx2g", "-XX:InitialRAMPercentage=25.0"},
+			notFlags:    []string{"-XX:MaxRAMPercentage=70.0"},
+		},
+		{
+			name:        "Java11ClampedUp",
+			javaVersion: "v11.0",
+			mem:         1 * gb,
+			minHeap:     768 * tuner.MiB,
+			wantFlags:   []string{"-Xmx768m"},
+			notFlags:    []string{"-XX:MaxRAMPercentage=70.0"},
+		},
+		{
+			name:        "Java11Headroom",
+			javaVersion: "v11.0",
+			mem:         2 * gb,
+			headroom:    512 * tuner.MiB,
+			wantFlags:   []string{"-XX:MaxRAMPercentage=70.0", "-XX:MaxRAM=1536m"},
+		},
+		{
+			name:        "Java8ClampedDown",
+			javaVersion: "v1.8.0",
+			mem:         8 * gb,
+			maxHeap:     2 * gb,
+			wantFlags:   []string{"-Xmx2048m", "-Xms2048m"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:   tc.javaVersion,
+				CPUCount:      2,
+				MemLimit:      tc.mem,
+				MemPercentage: 70.0,
+				MinHeap:       tc.minHeap,
+				MaxHeap:       tc.maxHeap,
+				Headroom:      tc.headroom,
+			})
+			assert.NoError(t, err)
+			for _, flag := range tc.wantFlags {
+				assert.Contains(t, opts.MemoryOpts, flag)
+			}
+			for _, flag := range tc.notFlags {
+				assert.NotContains(t, opts.MemoryOpts, flag)
+			}
+		})
+	}
+}
+
+func TestTune_HeapBoundsInvalid(t *testing.T) {
+	_, err := tuner.Tune(tuner.Params{
+		JavaVersion:   "v11.0",
+		CPUCount:      2,
+		MemLimit:      2 * gb,
+		MemPercentage: 70.0,
+		MinHeap:       2 * gb,
+		MaxHeap:       1 * gb,
+	})
+	assert.Error(t, err)
+}
+
+func TestTune_CompressedOops(t *testing.T) {
+	cases := []struct {
+		name        string
+		javaVersion string
+		mem         uint64
+		noCap       bool
+		extra       []string
+		wantFlags   []string
+		notFlags    []string
+	}{
+		{
+			name:        "BelowLimit",
+			javaVersion: "v17.0.16",
+			mem:         32 * gb,
+			wantFlags:   []string{"-XX:MaxRAMPercentage=80.0"},
+		},
+		{
+			name:        "InCliff",
+			javaVersion: "v17.0.16",
+			mem:         48 * gb,
+			wantFlags:   []string{"-Xmx31g"},
+			notFlags:    []string{"-XX:MaxRAMPercentage=80.0"},
+		},
+		{
+			name:        "InCliffOptOut",
+			javaVersion: "v17.0.16",
+			mem:         48 * gb,
+			noCap:       true,
+			wantFlags:   []string{"-XX:MaxRAMPercentage=80.0"},
+		},
+		{
+			name:        "InCliffBiggerAlignment",
+			javaVersion: "v17.0.16",
+			mem:         48 * gb,
+			extra:       []string{"-XX:ObjectAlignmentInBytes=16"},
+			wantFlags:   []string{"-XX:MaxRAMPercentage=80.0"},
+		},
+		{
+			name:        "InCliffZGC",
+			javaVersion: "v21.0.8",
+			mem:         48 * gb,
+			wantFlags:   []string{"-XX:MaxRAMPercentage=80.0", "-XX:+UseZGC"},
+		},
+		{
+			name:        "AboveCliff",
+			javaVersion: "v17.0.16",
+			mem:         64 * gb,
+			wantFlags:   []string{"-XX:MaxRAMPercentage=80.0"},
+		},
+		{
+			name:        "Java8InCliff",
+			javaVersion: "v1.8.0",
+			mem:         48 * gb,
+			wantFlags:   []string{"-Xmx31744m", "-Xms31744m"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tuner.Tune(tuner.Params{
+				JavaVersion:         tc.javaVersion,
+				Vendor:              tuner.VendorOracle,
+				CPUCount:            8,
+				MemLimit:            tc.mem,
+				MemPercentage:       80.0,
+				NoCompressedOopsCap: tc.noCap,
+				OtherFlags:          tc.extra,
+			})
+			assert.NoError(t, err)
 			args := tuner.FormatOptions(opts)
 			for _, flag := range tc.wantFlags {
 				assert.Contains(t, args, flag)
 			}
+			for _, flag := range tc.notFlags {
+				assert.NotContains(t, args, flag)
+			}
 		})
 	}
 }